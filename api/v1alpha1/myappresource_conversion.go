@@ -0,0 +1,169 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// Annotations used to carry fields that only exist in one of the versions, so
+// that converting back and forth never loses data.
+const (
+	// FooAnnotation holds the v1alpha1 spec.foo field on v1beta1 objects.
+	FooAnnotation = "my.api.group.rama.angi.platform/v1alpha1-foo"
+	// ConversionDataAnnotation holds the v1beta1 spec and status on v1alpha1
+	// objects when they cannot be expressed in v1alpha1.
+	ConversionDataAnnotation = "my.api.group.rama.angi.platform/conversion-data"
+)
+
+// conversionData holds the parts of a v1beta1 object that v1alpha1 cannot
+// express. Status fields that v1alpha1 does express are left out to keep the
+// annotation small.
+type conversionData struct {
+	Spec   v1beta1.MyAppResourceSpec   `json:"spec"`
+	Status v1beta1.MyAppResourceStatus `json:"status,omitempty"`
+}
+
+var _ conversion.Convertible = &MyAppResource{}
+
+// ConvertTo converts this MyAppResource to the Hub version (v1beta1).
+func (src *MyAppResource) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.MyAppResource)
+
+	// Start from the v1beta1 fields stored by ConvertFrom, if any, so that
+	// fields without a v1alpha1 equivalent survive the round trip
+	restored := conversionData{}
+	if data, ok := src.Annotations[ConversionDataAnnotation]; ok {
+		if err := json.Unmarshal([]byte(data), &restored); err != nil {
+			return fmt.Errorf("failed to restore v1beta1 fields from annotation %s: %w", ConversionDataAnnotation, err)
+		}
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	deleteAnnotation(&dst.ObjectMeta.Annotations, ConversionDataAnnotation)
+	if src.Spec.Foo != "" {
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[FooAnnotation] = src.Spec.Foo
+	}
+
+	dst.Spec = restored.Spec
+	dst.Spec.ReplicaCount = src.Spec.ReplicaCount
+	dst.Spec.Image.Repository = src.Spec.Image.Repository
+	dst.Spec.Image.Tag = src.Spec.Image.Tag
+	dst.Spec.Resources.Requests.CPU = src.Spec.Resources.CPURequest
+	if dst.Spec.Resources.Limits.Memory != src.Spec.Resources.MemoryLimit {
+		// The memory limit was changed through v1alpha1, so a stored request
+		// may no longer fit and is defaulted from the new limit instead
+		dst.Spec.Resources.Limits.Memory = src.Spec.Resources.MemoryLimit
+		dst.Spec.Resources.Requests.Memory = ""
+	}
+	dst.Spec.UI.Color = src.Spec.UI.Color
+	dst.Spec.UI.Message = src.Spec.UI.Message
+	dst.Spec.Redis.Enabled = src.Spec.Redis.Enabled
+	if src.Spec.Redis.ReplicaCount != nil {
+		replicas := *src.Spec.Redis.ReplicaCount
+		dst.Spec.Redis.ReplicaCount = &replicas
+	} else {
+		dst.Spec.Redis.ReplicaCount = nil
+	}
+
+	dst.Status = restored.Status
+	dst.Status.ObservedGeneration = src.Status.ObservedGeneration
+	dst.Status.Conditions = src.Status.DeepCopy().Conditions
+	dst.Status.Image = src.Status.Image
+	dst.Status.App.WorkloadStatus = v1beta1.WorkloadStatus(src.Status.App.WorkloadStatus)
+	dst.Status.Redis.WorkloadStatus = v1beta1.WorkloadStatus(src.Status.Redis.WorkloadStatus)
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *MyAppResource) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.MyAppResource)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec.Foo = src.Annotations[FooAnnotation]
+	deleteAnnotation(&dst.ObjectMeta.Annotations, FooAnnotation)
+	deleteAnnotation(&dst.ObjectMeta.Annotations, ConversionDataAnnotation)
+
+	dst.Spec.ReplicaCount = src.Spec.ReplicaCount
+	dst.Spec.Image = ImageSpec{
+		Repository: src.Spec.Image.Repository,
+		Tag:        src.Spec.Image.Tag,
+	}
+	dst.Spec.Resources = ResourceSpec{
+		CPURequest:  src.Spec.Resources.Requests.CPU,
+		MemoryLimit: src.Spec.Resources.Limits.Memory,
+	}
+	dst.Spec.UI = UserInterface{
+		Color:   src.Spec.UI.Color,
+		Message: src.Spec.UI.Message,
+	}
+	dst.Spec.Redis = RedisSpec{Enabled: src.Spec.Redis.Enabled}
+	if src.Spec.Redis.ReplicaCount != nil {
+		replicas := *src.Spec.Redis.ReplicaCount
+		dst.Spec.Redis.ReplicaCount = &replicas
+	}
+
+	dst.Status = MyAppResourceStatus{
+		ObservedGeneration: src.Status.ObservedGeneration,
+		Conditions:         src.Status.DeepCopy().Conditions,
+		Image:              src.Status.Image,
+		App:                AppStatus{WorkloadStatus: WorkloadStatus(src.Status.App.WorkloadStatus)},
+		Redis:              RedisStatus{WorkloadStatus: WorkloadStatus(src.Status.Redis.WorkloadStatus)},
+	}
+
+	// Keep the v1beta1 fields in an annotation when v1alpha1 cannot express them
+	roundTrip := &v1beta1.MyAppResource{}
+	if err := dst.ConvertTo(roundTrip); err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(roundTrip.Spec, src.Spec) || !equality.Semantic.DeepEqual(roundTrip.Status, src.Status) {
+		stored := conversionData{Spec: src.Spec, Status: *src.Status.DeepCopy()}
+		stored.Status.ObservedGeneration = 0
+		stored.Status.Conditions = nil
+		stored.Status.Image = ""
+		stored.Status.App.WorkloadStatus = v1beta1.WorkloadStatus{}
+		stored.Status.Redis.WorkloadStatus = v1beta1.WorkloadStatus{}
+		data, err := json.Marshal(stored)
+		if err != nil {
+			return fmt.Errorf("failed to store v1beta1 fields in annotation %s: %w", ConversionDataAnnotation, err)
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[ConversionDataAnnotation] = string(data)
+	}
+
+	return nil
+}
+
+// deleteAnnotation removes an annotation and drops the map once it is empty.
+func deleteAnnotation(annotations *map[string]string, key string) {
+	delete(*annotations, key)
+	if len(*annotations) == 0 {
+		*annotations = nil
+	}
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+var _ = Describe("MyAppResource Conversion", func() {
+	var spoke *MyAppResource
+	var hub *v1beta1.MyAppResource
+
+	BeforeEach(func() {
+		spoke = &MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "conversion-test",
+				Namespace:   "default",
+				Annotations: map[string]string{"team": "platform"},
+			},
+			Spec: MyAppResourceSpec{
+				Foo:          "bar",
+				ReplicaCount: 2,
+				Resources: ResourceSpec{
+					MemoryLimit: "64Mi",
+					CPURequest:  "100m",
+				},
+				Image: ImageSpec{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "latest",
+				},
+				UI: UserInterface{
+					Color:   "34577c",
+					Message: "Hey there",
+				},
+				Redis: RedisSpec{Enabled: true, ReplicaCount: ptr.To(int32(1))},
+			},
+			Status: MyAppResourceStatus{
+				ObservedGeneration: 3,
+				Image:              "ghcr.io/stefanprodan/podinfo:latest",
+				App:                AppStatus{WorkloadStatus: WorkloadStatus{Replicas: 2, ReadyReplicas: 1, UpdatedReplicas: 2}},
+				Conditions: []metav1.Condition{{
+					Type:               ConditionAvailable,
+					Status:             metav1.ConditionFalse,
+					Reason:             "ReplicasNotReady",
+					LastTransitionTime: metav1.Now(),
+				}},
+			},
+		}
+
+		hub = &v1beta1.MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "conversion-test",
+				Namespace: "default",
+			},
+			Spec: v1beta1.MyAppResourceSpec{
+				ReplicaCount: 2,
+				Image: v1beta1.ImageSpec{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "6.5.4",
+					PullPolicy: corev1.PullIfNotPresent,
+				},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+				Resources: v1beta1.ResourceRequirements{
+					Requests: v1beta1.ResourceList{CPU: "100m", Memory: "32Mi"},
+					Limits:   v1beta1.ResourceList{CPU: "500m", Memory: "64Mi"},
+				},
+				UI: v1beta1.UserInterface{Color: "34577c", Message: "Hey there"},
+				Redis: v1beta1.RedisSpec{
+					Enabled:      true,
+					ReplicaCount: ptr.To(int32(1)),
+					Image:        v1beta1.ImageSpec{Repository: "redis", Tag: "7.2"},
+				},
+			},
+			Status: v1beta1.MyAppResourceStatus{
+				ObservedGeneration: 1,
+				Redis: v1beta1.RedisStatus{
+					WorkloadStatus: v1beta1.WorkloadStatus{Replicas: 1, ReadyReplicas: 1, UpdatedReplicas: 1},
+					Endpoint:       "conversion-test-redis.default.svc:6379",
+				},
+			},
+		}
+	})
+
+	Context("When converting v1alpha1 to v1beta1", func() {
+		It("Should map every field to its v1beta1 equivalent", func() {
+			converted := &v1beta1.MyAppResource{}
+			Expect(spoke.ConvertTo(converted)).To(Succeed())
+
+			Expect(converted.Spec.ReplicaCount).To(Equal(int32(2)))
+			Expect(converted.Spec.Image.Tag).To(Equal("latest"))
+			Expect(converted.Spec.Resources.Requests.CPU).To(Equal("100m"))
+			Expect(converted.Spec.Resources.Limits.Memory).To(Equal("64Mi"))
+			Expect(converted.Spec.Redis.ReplicaCount).To(Equal(ptr.To(int32(1))))
+			Expect(converted.Annotations).To(HaveKeyWithValue(FooAnnotation, "bar"))
+			Expect(converted.Annotations).To(HaveKeyWithValue("team", "platform"))
+			Expect(converted.Status.App.ReadyReplicas).To(Equal(int32(1)))
+			Expect(converted.Status.Conditions).To(HaveLen(1))
+		})
+
+		It("Should round-trip without losing data", func() {
+			converted := &v1beta1.MyAppResource{}
+			Expect(spoke.ConvertTo(converted)).To(Succeed())
+
+			restored := &MyAppResource{}
+			Expect(restored.ConvertFrom(converted)).To(Succeed())
+
+			Expect(restored).To(Equal(spoke))
+		})
+	})
+
+	Context("When converting v1beta1 to v1alpha1", func() {
+		It("Should keep fields v1alpha1 cannot express in an annotation", func() {
+			converted := &MyAppResource{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+
+			Expect(converted.Spec.Resources.CPURequest).To(Equal("100m"))
+			Expect(converted.Spec.Resources.MemoryLimit).To(Equal("64Mi"))
+			Expect(converted.Annotations).To(HaveKey(ConversionDataAnnotation))
+		})
+
+		It("Should not annotate objects that convert without loss", func() {
+			converted := &v1beta1.MyAppResource{}
+			Expect(spoke.ConvertTo(converted)).To(Succeed())
+
+			restored := &MyAppResource{}
+			Expect(restored.ConvertFrom(converted)).To(Succeed())
+
+			Expect(restored.Annotations).NotTo(HaveKey(ConversionDataAnnotation))
+		})
+
+		It("Should round-trip without losing data", func() {
+			converted := &MyAppResource{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+
+			restored := &v1beta1.MyAppResource{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+
+			Expect(restored).To(Equal(hub))
+		})
+
+		It("Should apply changes made through v1alpha1 on top of the stored fields", func() {
+			converted := &MyAppResource{}
+			Expect(converted.ConvertFrom(hub)).To(Succeed())
+			converted.Spec.ReplicaCount = 5
+			converted.Spec.Resources.MemoryLimit = "16Mi"
+
+			restored := &v1beta1.MyAppResource{}
+			Expect(converted.ConvertTo(restored)).To(Succeed())
+
+			Expect(restored.Spec.ReplicaCount).To(Equal(int32(5)))
+			Expect(restored.Spec.Image.PullPolicy).To(Equal(corev1.PullIfNotPresent))
+			Expect(restored.Spec.Resources.Limits.Memory).To(Equal("16Mi"))
+			Expect(restored.Spec.Resources.Requests.Memory).To(BeEmpty())
+			Expect(restored.Annotations).NotTo(HaveKey(ConversionDataAnnotation))
+		})
+	})
+
+	Context("When updating an object with standalone Redis replicas", func() {
+		It("Should migrate it to sentinel mode so that later updates are admitted", func() {
+			spoke.Spec.Redis.ReplicaCount = ptr.To(int32(3))
+			stored := &v1beta1.MyAppResource{}
+			Expect(spoke.ConvertTo(stored)).To(Succeed())
+
+			// The stored object still carries the mode of the defaulting
+			// webhook of earlier versions
+			stored.Spec.Redis.Mode = v1beta1.RedisModeStandalone
+
+			// A later update through v1alpha1
+			read := &MyAppResource{}
+			Expect(read.ConvertFrom(stored)).To(Succeed())
+			read.Spec.UI.Message = "Hello"
+			updated := &v1beta1.MyAppResource{}
+			Expect(read.ConvertTo(updated)).To(Succeed())
+			updated.Default()
+
+			Expect(updated.Spec.Redis.Mode).To(Equal(v1beta1.RedisModeSentinel))
+			Expect(updated.Spec.Redis.ReplicaCount).To(Equal(ptr.To(int32(3))))
+			_, err := updated.ValidateUpdate(stored)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("When served by the API server", func() {
+		It("Should read v1alpha1 objects back as v1beta1", func() {
+			spoke.Status = MyAppResourceStatus{}
+			Expect(k8sClient.Create(ctx, spoke)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, spoke)
+
+			stored := &v1beta1.MyAppResource{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(spoke), stored)).To(Succeed())
+			Expect(stored.Spec.Resources.Limits.Memory).To(Equal("64Mi"))
+			Expect(stored.Annotations).To(HaveKeyWithValue(FooAnnotation, "bar"))
+
+			read := &MyAppResource{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(spoke), read)).To(Succeed())
+			Expect(read.Spec.Foo).To(Equal("bar"))
+			Expect(read.Spec.Image).To(Equal(spoke.Spec.Image))
+		})
+	})
+})
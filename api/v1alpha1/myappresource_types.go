@@ -31,48 +31,116 @@ type MyAppResourceSpec struct {
 	// Important: Run "make" to regenerate code after modifying this file
 
 	// Foo is an example field of MyAppResource. Edit myappresource_types.go to remove/update
-	Foo          string        `json:"foo,omitempty"`
-	ReplicaCount int32         `json:"replicaCount"`
-	Resources    ResourceSpec  `json:"resources"`
-	Image        ImageSpec     `json:"image"`
-	UI           UserInterface `json:"ui"`
-	Redis        RedisSpec     `json:"redis"`
+	Foo          string `json:"foo,omitempty"`
+	ReplicaCount int32  `json:"replicaCount"`
+	// +optional
+	Resources ResourceSpec `json:"resources,omitempty"`
+	Image     ImageSpec    `json:"image"`
+	// +optional
+	UI    UserInterface `json:"ui,omitempty"`
+	Redis RedisSpec     `json:"redis"`
 }
 
 // ResourceSpec defines the resource requirements for the application
 type ResourceSpec struct {
-	MemoryLimit string `json:"memoryLimit"`
-	CPURequest  string `json:"cpuRequest"`
+	// MemoryLimit is the memory request and limit of the application container.
+	// +optional
+	MemoryLimit string `json:"memoryLimit,omitempty"`
+	// CPURequest is the CPU request of the application container.
+	// +optional
+	CPURequest string `json:"cpuRequest,omitempty"`
 }
 
 // ImageSpec defines the image repository and tag for the application
 type ImageSpec struct {
 	Repository string `json:"repository"`
-	Tag        string `json:"tag"`
+	// +optional
+	Tag string `json:"tag,omitempty"`
 }
 
 // UserInterface defines the UI settings for the application
 type UserInterface struct {
-	Color   string `json:"color"`
-	Message string `json:"message"`
+	// +optional
+	Color string `json:"color,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
 }
 
 // RedisSpec defines the settings for Redis integration
 type RedisSpec struct {
-	Enabled      bool   `json:"enabled"`
+	Enabled bool `json:"enabled"`
+	// ReplicaCount is the number of Redis replicas. It defaults to 1 when Redis is enabled.
+	// +optional
 	ReplicaCount *int32 `json:"replicaCount,omitempty"`
 }
 
 //Complete
 
+// Condition types reported in MyAppResourceStatus.
+const (
+	// ConditionAvailable indicates that the application has the desired number of ready replicas.
+	ConditionAvailable = "Available"
+	// ConditionProgressing indicates that a rollout of the application is in progress.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded indicates that the controller could not reconcile the resource
+	// or that a rollout is stuck.
+	ConditionDegraded = "Degraded"
+	// ConditionRedisReady indicates that all Redis replicas are ready.
+	ConditionRedisReady = "RedisReady"
+)
+
+// WorkloadStatus describes the replicas of a workload managed by the controller
+type WorkloadStatus struct {
+	// Replicas is the desired number of replicas.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of replicas with a Ready condition.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// UpdatedReplicas is the number of replicas running the latest pod template.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+}
+
+// AppStatus defines the observed state of the application workload
+type AppStatus struct {
+	WorkloadStatus `json:",inline"`
+}
+
+// RedisStatus defines the observed state of the Redis workload
+type RedisStatus struct {
+	WorkloadStatus `json:",inline"`
+}
+
 // MyAppResourceStatus defines the observed state of MyAppResource
 type MyAppResourceStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the resource's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Image is the application image currently running in the updated pods.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// App reports the replicas of the application Deployment.
+	// +optional
+	App AppStatus `json:"app,omitempty"`
+
+	// Redis reports the replicas of the Redis Deployment.
+	// +optional
+	Redis RedisStatus `json:"redis,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".status.app.replicas"
+//+kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.app.readyReplicas"
+//+kubebuilder:printcolumn:name="Image",type="string",JSONPath=".status.image"
+//+kubebuilder:printcolumn:name="Available",type="string",JSONPath=".status.conditions[?(@.type==\"Available\")].status"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // MyAppResource is the Schema for the myappresources API
 type MyAppResource struct {
@@ -0,0 +1,694 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// MyAppResourceSpec defines the desired state of MyAppResource
+type MyAppResourceSpec struct {
+	// ReplicaCount is the number of application replicas. With autoscaling it
+	// is only the number of replicas the application starts with.
+	// +kubebuilder:validation:Minimum=0
+	ReplicaCount int32 `json:"replicaCount"`
+
+	// Autoscaling lets a HorizontalPodAutoscaler size the application between
+	// its minimum and maximum replicas. ReplicaCount only sets the initial
+	// size while it is enabled.
+	// +optional
+	Autoscaling *AutoscalingSpec `json:"autoscaling,omitempty"`
+
+	// MaxUnavailable is how many app pods may be taken down at once, as a
+	// number or a percentage of the current replicas, rounded up. Lowering the
+	// replica count removes pods in batches of this size, each started once the
+	// pods of the previous batch have terminated, and rolling updates take no
+	// more than this many pods out of service. It defaults to 25%.
+	// +kubebuilder:validation:XIntOrString
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// Image is the application container image.
+	Image ImageSpec `json:"image"`
+
+	// Rollout configures how a new version of the application is rolled out.
+	// Without a strategy the Deployment replaces all replicas in a rolling
+	// update. At most one strategy may be set.
+	// +optional
+	Rollout RolloutSpec `json:"rollout,omitempty"`
+
+	// ImagePullSecrets are the secrets used to pull the application image.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+
+	// Resources are the compute resources of the application container.
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// Probes configures the liveness, readiness and startup probes of the
+	// application container. The liveness and readiness probes default to the
+	// /healthz and /readyz endpoints of podinfo.
+	// +optional
+	Probes ProbesSpec `json:"probes,omitempty"`
+
+	// UI configures the user interface of the application.
+	// +optional
+	UI UserInterface `json:"ui,omitempty"`
+
+	// Service configures the Service the application is exposed through.
+	// +optional
+	Service ServiceSpec `json:"service,omitempty"`
+
+	// Ingress exposes the application outside the cluster through an Ingress.
+	// No Ingress is created when it is unset.
+	// +optional
+	Ingress *IngressSpec `json:"ingress,omitempty"`
+
+	// Redis configures the Redis instance deployed alongside the application.
+	// +optional
+	Redis RedisSpec `json:"redis,omitempty"`
+
+	// Disruption configures the PodDisruptionBudgets that limit how many app
+	// and Redis pods voluntary disruptions, such as node drains, may evict at
+	// once.
+	// +optional
+	Disruption DisruptionSpec `json:"disruption,omitempty"`
+
+	// PreDeleteHook is a Job run when the MyAppResource is deleted, after the
+	// application has been scaled to zero and Redis has been torn down.
+	// +optional
+	PreDeleteHook *PreDeleteHookSpec `json:"preDeleteHook,omitempty"`
+}
+
+// AutoscalingSpec defines the HorizontalPodAutoscaler of the application
+type AutoscalingSpec struct {
+	// MinReplicas is the lowest number of replicas. It defaults to 1.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MinReplicas *int32 `json:"minReplicas,omitempty"`
+
+	// MaxReplicas is the highest number of replicas.
+	// +kubebuilder:validation:Minimum=1
+	MaxReplicas int32 `json:"maxReplicas"`
+
+	// TargetCPUUtilizationPercentage is the average CPU usage across the
+	// replicas, as a percentage of the CPU request, to scale towards. It
+	// defaults to 80 when no memory target is set either.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetCPUUtilizationPercentage *int32 `json:"targetCPUUtilizationPercentage,omitempty"`
+
+	// TargetMemoryUtilizationPercentage is the average memory usage across
+	// the replicas, as a percentage of the memory request, to scale towards.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TargetMemoryUtilizationPercentage *int32 `json:"targetMemoryUtilizationPercentage,omitempty"`
+
+	// Behavior configures the scaling speed and stabilization windows in both
+	// directions. The HorizontalPodAutoscaler defaults are used when unset.
+	// +optional
+	Behavior *autoscalingv2.HorizontalPodAutoscalerBehavior `json:"behavior,omitempty"`
+}
+
+// ImageSpec defines a container image
+type ImageSpec struct {
+	// Repository is the image repository, for example ghcr.io/stefanprodan/podinfo.
+	Repository string `json:"repository"`
+
+	// Tag is the image tag.
+	// +optional
+	Tag string `json:"tag,omitempty"`
+
+	// PullPolicy is the image pull policy of the container.
+	// +kubebuilder:validation:Enum=Always;Never;IfNotPresent
+	// +optional
+	PullPolicy corev1.PullPolicy `json:"pullPolicy,omitempty"`
+}
+
+// ResourceRequirements defines the compute resources of a container
+type ResourceRequirements struct {
+	// Requests are the resources reserved for the container.
+	// +optional
+	Requests ResourceList `json:"requests,omitempty"`
+
+	// Limits are the maximum resources the container may use.
+	// +optional
+	Limits ResourceList `json:"limits,omitempty"`
+}
+
+// ResourceList defines CPU and memory quantities, for example 100m and 64Mi
+type ResourceList struct {
+	// +optional
+	CPU string `json:"cpu,omitempty"`
+	// +optional
+	Memory string `json:"memory,omitempty"`
+}
+
+// UserInterface defines the UI settings for the application
+type UserInterface struct {
+	// Color is the background color of the UI as a hex string.
+	// +optional
+	Color string `json:"color,omitempty"`
+
+	// Message is the greeting shown by the UI.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// ColorEnvName is the name of the environment variable the color is passed
+	// to the app container as, always with a leading '#'. It defaults to
+	// PODINFO_UI_COLOR; set it for images other than podinfo.
+	// +optional
+	ColorEnvName string `json:"colorEnvName,omitempty"`
+
+	// MessageEnvName is the name of the environment variable the message is
+	// passed to the app container as. It defaults to PODINFO_UI_MESSAGE.
+	// +optional
+	MessageEnvName string `json:"messageEnvName,omitempty"`
+}
+
+// ServiceSpec defines the Service in front of the application
+type ServiceSpec struct {
+	// Port is the port the Service listens on. It defaults to 9898, the port
+	// podinfo listens on.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Type is the type of the Service. It defaults to ClusterIP.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Annotations are added to the Service, for example to configure a cloud
+	// load balancer.
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// IngressSpec defines the Ingress routing external traffic to the application
+type IngressSpec struct {
+	// Host is the host name the Ingress serves. All hosts are served when it
+	// is unset.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// Path is the path prefix routed to the application. It defaults to /.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// TLSSecretName is the name of the Secret holding the TLS certificate of
+	// the host. TLS is not terminated when it is unset.
+	// +optional
+	TLSSecretName string `json:"tlsSecretName,omitempty"`
+
+	// ClassName is the IngressClass that implements the Ingress. The cluster
+	// default class is used when it is unset.
+	// +optional
+	ClassName *string `json:"className,omitempty"`
+}
+
+// DisruptionSpec defines the PodDisruptionBudgets of the app and of Redis
+type DisruptionSpec struct {
+	// App is the budget of the application pods.
+	// +optional
+	App DisruptionBudget `json:"app,omitempty"`
+
+	// Redis is the budget of the Redis pods. In sentinel mode the Sentinels
+	// also get a budget keeping enough of them up to reach the quorum.
+	// +optional
+	Redis DisruptionBudget `json:"redis,omitempty"`
+}
+
+// DisruptionBudget defines a PodDisruptionBudget. At most one of MinAvailable
+// and MaxUnavailable may be set. When neither is, a workload that can run more
+// than one replica may lose one pod at a time, and a single replica gets no
+// budget since it could only block node drains.
+type DisruptionBudget struct {
+	// Disabled removes the budget.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// MinAvailable is the number or percentage of pods that must stay available.
+	// +optional
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+
+	// MaxUnavailable is the number or percentage of pods that may be unavailable.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// RolloutSpec defines the rollout strategy of the application
+type RolloutSpec struct {
+	// Canary runs a new version on a growing share of the replicas, step by
+	// step, before it replaces the stable version.
+	// +optional
+	Canary *CanaryStrategy `json:"canary,omitempty"`
+
+	// BlueGreen runs a full copy of a new version behind a preview Service
+	// and moves all traffic to it at once when it is promoted.
+	// +optional
+	BlueGreen *BlueGreenStrategy `json:"blueGreen,omitempty"`
+}
+
+// CanaryStrategy defines the steps of a canary rollout. A change to the app
+// pod template, such as a new image tag, starts a canary ReplicaSet running
+// the new version next to the stable Deployment. Once the last step has passed
+// the new version is promoted to the Deployment.
+type CanaryStrategy struct {
+	// Steps are the shares of the replicas running the new version, in order.
+	// +kubebuilder:validation:MinItems=1
+	Steps []CanaryStep `json:"steps"`
+
+	// ReadinessTimeout is how long the canary pods may stay unready before
+	// the canary is aborted and the stable version is restored. It defaults
+	// to 5m.
+	// +optional
+	ReadinessTimeout *metav1.Duration `json:"readinessTimeout,omitempty"`
+}
+
+// CanaryStep defines one step of a canary rollout
+type CanaryStep struct {
+	// Weight is the percentage of the replicas that run the new version.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=100
+	Weight int32 `json:"weight"`
+
+	// Pause is how long the step is held once its canary pods are ready. The
+	// next step starts right away when it is unset.
+	// +optional
+	Pause *metav1.Duration `json:"pause,omitempty"`
+}
+
+// BlueGreenStrategy defines a blue/green rollout. A change to the app pod
+// template starts a preview ReplicaSet running the new version with as many
+// replicas as the app, reachable through the <name>-preview Service. Once
+// promoted, the app Service switches to the preview pods and the previous
+// version is kept for the rollback window before the Deployment is moved to
+// the new version.
+type BlueGreenStrategy struct {
+	// AutoPromoteAfter promotes the preview once its pods have been ready for
+	// this long. Without it the preview waits for the PromoteAnnotation.
+	// +optional
+	AutoPromoteAfter *metav1.Duration `json:"autoPromoteAfter,omitempty"`
+
+	// RollbackWindow is how long the previous version keeps running after a
+	// promotion, so that reverting the spec moves the traffic back at once.
+	// It defaults to 10m.
+	// +optional
+	RollbackWindow *metav1.Duration `json:"rollbackWindow,omitempty"`
+}
+
+// ProbesSpec defines the probes of a container
+type ProbesSpec struct {
+	// Liveness restarts the container when it fails.
+	// +optional
+	Liveness *Probe `json:"liveness,omitempty"`
+
+	// Readiness takes the pod out of its Services while it fails.
+	// +optional
+	Readiness *Probe `json:"readiness,omitempty"`
+
+	// Startup holds off the other probes until it succeeds. There is no
+	// startup probe unless it is set.
+	// +optional
+	Startup *Probe `json:"startup,omitempty"`
+}
+
+// Probe defines a container probe. A probe without an action gets the default
+// action of its kind, so only the thresholds of a default probe can be changed.
+type Probe struct {
+	// Disabled removes the probe.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	corev1.Probe `json:",inline"`
+}
+
+// RedisMode selects how Redis is deployed
+// +kubebuilder:validation:Enum=standalone;sentinel
+type RedisMode string
+
+const (
+	// RedisModeStandalone runs a single Redis instance without replication or
+	// failover.
+	RedisModeStandalone RedisMode = "standalone"
+	// RedisModeSentinel runs a primary with replicas and a Sentinel quorum
+	// that promotes a replica when the primary fails.
+	RedisModeSentinel RedisMode = "sentinel"
+)
+
+// RedisSpec defines the settings for Redis integration
+type RedisSpec struct {
+	// Enabled deploys Redis alongside the application.
+	Enabled bool `json:"enabled"`
+
+	// Mode selects a standalone Redis or a primary with replicas monitored by
+	// Sentinel. It defaults to standalone, or to sentinel when replicaCount is
+	// above 1.
+	// +optional
+	Mode RedisMode `json:"mode,omitempty"`
+
+	// ReplicaCount is the number of Redis replicas. It defaults to 1 when Redis
+	// is enabled, or 3 in sentinel mode, where it includes the primary. More
+	// than one replica moves a standalone Redis to sentinel mode.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	ReplicaCount *int32 `json:"replicaCount,omitempty"`
+
+	// Image is the Redis container image.
+	// +optional
+	Image ImageSpec `json:"image,omitempty"`
+
+	// Resources are the compute resources of the Redis container.
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+
+	// Probes configures the probes of the Redis container. The liveness and
+	// readiness probes default to redis-cli ping.
+	// +optional
+	Probes ProbesSpec `json:"probes,omitempty"`
+
+	// AddressEnvName is the name of the environment variable the Redis address
+	// is injected into the app container as, in the form tcp://<host>:<port>.
+	// +optional
+	AddressEnvName string `json:"addressEnvName,omitempty"`
+
+	// PasswordEnvName is the name of the environment variable the Redis password
+	// is injected into the app container as. The value is read from the Secret
+	// generated by the controller.
+	// +optional
+	PasswordEnvName string `json:"passwordEnvName,omitempty"`
+
+	// Persistence stores the Redis data on a PersistentVolumeClaim per replica.
+	// Without it the data lives in an emptyDir and is lost when a pod restarts.
+	// +optional
+	Persistence *RedisPersistenceSpec `json:"persistence,omitempty"`
+
+	// Sentinel configures the Sentinel quorum in sentinel mode.
+	// +optional
+	Sentinel *RedisSentinelSpec `json:"sentinel,omitempty"`
+}
+
+// RedisSentinelSpec defines the Sentinel quorum that monitors Redis
+type RedisSentinelSpec struct {
+	// Replicas is the number of Sentinel instances. It defaults to 3.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Quorum is the number of Sentinels that must agree the primary is down
+	// before a failover starts. It defaults to a majority of the replicas.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Quorum *int32 `json:"quorum,omitempty"`
+
+	// Resources are the compute resources of the Sentinel container.
+	// +optional
+	Resources ResourceRequirements `json:"resources,omitempty"`
+}
+
+// RedisPersistenceSpec defines the storage and persistence settings of Redis
+type RedisPersistenceSpec struct {
+	// Size is the requested size of each volume, for example 1Gi.
+	// +optional
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName is the storage class of the volumes. The cluster default
+	// storage class is used when it is unset.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessMode is the access mode of the volumes.
+	// +kubebuilder:validation:Enum=ReadWriteOnce;ReadWriteOncePod;ReadWriteMany
+	// +optional
+	AccessMode corev1.PersistentVolumeAccessMode `json:"accessMode,omitempty"`
+
+	// AppendOnly enables the append only file (AOF).
+	// +optional
+	AppendOnly *bool `json:"appendOnly,omitempty"`
+
+	// Save is the RDB snapshot schedule as "<seconds> <changes>" pairs, for
+	// example "3600 1 300 100".
+	// +optional
+	Save string `json:"save,omitempty"`
+}
+
+// PreDeleteHookSpec defines the Job run before the MyAppResource is removed
+type PreDeleteHookSpec struct {
+	// Image is the hook container image. It defaults to the application image.
+	// +optional
+	Image ImageSpec `json:"image,omitempty"`
+
+	// Command overrides the entrypoint of the image.
+	// +optional
+	Command []string `json:"command,omitempty"`
+
+	// Args are the arguments passed to the command.
+	// +optional
+	Args []string `json:"args,omitempty"`
+
+	// BackoffLimit is the number of retries before the hook is considered failed.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	BackoffLimit *int32 `json:"backoffLimit,omitempty"`
+
+	// ActiveDeadlineSeconds limits how long the hook may run.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ActiveDeadlineSeconds *int64 `json:"activeDeadlineSeconds,omitempty"`
+}
+
+// RotateRedisPasswordAnnotation requests a new Redis password when it is set
+// on a MyAppResource. Any value works; setting a value that has not been seen
+// before, such as the current time, triggers a rotation.
+const RotateRedisPasswordAnnotation = "my.api.group.rama.angi.platform/rotate-redis-password"
+
+// PromoteAnnotation promotes the preview of a blue/green rollout when it is
+// set on a MyAppResource to the revision in .status.rollout.revision, so an
+// approval only ever applies to the version that was reviewed.
+const PromoteAnnotation = "my.api.group.rama.angi.platform/promote"
+
+// Condition types reported in MyAppResourceStatus.
+const (
+	// ConditionAvailable indicates that the application has the desired number of ready replicas.
+	ConditionAvailable = "Available"
+	// ConditionProgressing indicates that a rollout of the application is in progress.
+	ConditionProgressing = "Progressing"
+	// ConditionDegraded indicates that the controller could not reconcile the resource
+	// or that a rollout is stuck.
+	ConditionDegraded = "Degraded"
+	// ConditionRedisReady indicates that all Redis replicas are ready.
+	ConditionRedisReady = "RedisReady"
+	// ConditionCanary indicates that a canary of a new app version is in
+	// progress. It is false once the canary is promoted or aborted.
+	ConditionCanary = "Canary"
+	// ConditionBlueGreen indicates that a blue/green rollout of a new app
+	// version is in progress. It is false once it is promoted or rolled back.
+	ConditionBlueGreen = "BlueGreen"
+	// ConditionTerminating reports the progress of the teardown once the
+	// resource has been deleted.
+	ConditionTerminating = "Terminating"
+	// ConditionSpecInvalid indicates that the spec fails validation, so the
+	// controller leaves the workloads as they are until it is fixed.
+	ConditionSpecInvalid = "SpecInvalid"
+	// ConditionFieldConflict indicates that another field manager set fields
+	// the controller applies to other values, or that another controller
+	// controls an object the controller applies, so the controller leaves
+	// them as they are until the conflict is resolved.
+	ConditionFieldConflict = "FieldConflict"
+)
+
+// WorkloadStatus describes the replicas of a workload managed by the controller
+type WorkloadStatus struct {
+	// Replicas is the desired number of replicas.
+	Replicas int32 `json:"replicas"`
+	// ReadyReplicas is the number of replicas with a Ready condition.
+	ReadyReplicas int32 `json:"readyReplicas"`
+	// UpdatedReplicas is the number of replicas running the latest pod template.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+}
+
+// AppStatus defines the observed state of the application workload
+type AppStatus struct {
+	WorkloadStatus `json:",inline"`
+
+	// Endpoint is the in-cluster address of the app Service as <host>:<port>.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// URL is the address the application is reachable at through the Ingress.
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+// RedisStatus defines the observed state of the Redis workload
+type RedisStatus struct {
+	WorkloadStatus `json:",inline"`
+
+	// Endpoint is the in-cluster address of the Redis Service as <host>:<port>.
+	// +optional
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// PasswordSecret is the name of the Secret holding the Redis password.
+	// +optional
+	PasswordSecret string `json:"passwordSecret,omitempty"`
+
+	// LastPasswordRotationTime is when the Redis password was last rotated
+	// through the RotateRedisPasswordAnnotation.
+	// +optional
+	LastPasswordRotationTime *metav1.Time `json:"lastPasswordRotationTime,omitempty"`
+
+	// Primary is the name of the pod Sentinel reports as the current primary.
+	// It is only set in sentinel mode.
+	// +optional
+	Primary string `json:"primary,omitempty"`
+
+	// Failovers is the number of times the controller has seen the primary
+	// move to another pod.
+	// +optional
+	Failovers int32 `json:"failovers,omitempty"`
+
+	// Sentinel reports the replicas of the Sentinel StatefulSet in sentinel mode.
+	// +optional
+	Sentinel *WorkloadStatus `json:"sentinel,omitempty"`
+
+	// Removed lists the Redis objects deleted when Redis was last disabled,
+	// as <kind>/<name>.
+	// +optional
+	Removed []string `json:"removed,omitempty"`
+}
+
+// RolloutPhase is the state of a canary or blue/green rollout
+type RolloutPhase string
+
+const (
+	// RolloutPhaseProgressing means the canary is going through its steps.
+	RolloutPhaseProgressing RolloutPhase = "Progressing"
+	// RolloutPhaseAborted means the canary pods did not become ready in time.
+	// The revision is not tried again.
+	RolloutPhaseAborted RolloutPhase = "Aborted"
+	// RolloutPhasePreview means the new version runs behind the preview
+	// Service and waits to be promoted.
+	RolloutPhasePreview RolloutPhase = "Preview"
+	// RolloutPhasePromoted means the new version of a blue/green rollout
+	// takes the traffic and the previous one is kept for the rollback window.
+	RolloutPhasePromoted RolloutPhase = "Promoted"
+	// RolloutPhasePromoting means the new version is rolling out to the
+	// Deployment, and the canary or preview pods are removed once it has.
+	RolloutPhasePromoting RolloutPhase = "Promoting"
+)
+
+// RolloutStatus reports the progress of a canary or blue/green rollout
+type RolloutStatus struct {
+	// Phase is the state of the rollout.
+	Phase RolloutPhase `json:"phase"`
+
+	// Revision identifies the version of the app pod template being rolled
+	// out.
+	Revision string `json:"revision"`
+
+	// StableRevision identifies the version the app Deployment runs.
+	// +optional
+	StableRevision string `json:"stableRevision,omitempty"`
+
+	// Step is the index of the current canary step.
+	Step int32 `json:"step"`
+
+	// StepReadyTime is when the canary pods of the current step, or the
+	// preview pods, became ready.
+	// +optional
+	StepReadyTime *metav1.Time `json:"stepReadyTime,omitempty"`
+
+	// UnreadySince is when the canary pods stopped being all ready.
+	// +optional
+	UnreadySince *metav1.Time `json:"unreadySince,omitempty"`
+
+	// PromotedTime is when the new version of a blue/green rollout took
+	// over the traffic.
+	// +optional
+	PromotedTime *metav1.Time `json:"promotedTime,omitempty"`
+
+	// Replicas reports the pods running the new version in the canary or
+	// preview ReplicaSet.
+	// +optional
+	Replicas WorkloadStatus `json:"replicas,omitempty"`
+}
+
+// MyAppResourceStatus defines the observed state of MyAppResource
+type MyAppResourceStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions represent the latest available observations of the resource's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Image is the application image currently running in the updated pods.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// App reports the replicas of the application Deployment.
+	// +optional
+	App AppStatus `json:"app,omitempty"`
+
+	// Redis reports the replicas of the Redis StatefulSet.
+	// +optional
+	Redis RedisStatus `json:"redis,omitempty"`
+
+	// Rollout reports the progress of a canary or blue/green rollout.
+	// +optional
+	Rollout *RolloutStatus `json:"rollout,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".status.app.replicas"
+//+kubebuilder:printcolumn:name="Ready",type="integer",JSONPath=".status.app.readyReplicas"
+//+kubebuilder:printcolumn:name="Image",type="string",JSONPath=".status.image"
+//+kubebuilder:printcolumn:name="Available",type="string",JSONPath=".status.conditions[?(@.type==\"Available\")].status"
+//+kubebuilder:printcolumn:name="URL",type="string",JSONPath=".status.app.url",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// MyAppResource is the Schema for the myappresources API
+type MyAppResource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MyAppResourceSpec   `json:"spec,omitempty"`
+	Status MyAppResourceStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MyAppResourceList contains a list of MyAppResource
+type MyAppResourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MyAppResource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MyAppResource{}, &MyAppResourceList{})
+}
@@ -0,0 +1,755 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var myappresourcelog = logf.Log.WithName("myappresource-resource")
+
+// Default values applied to unset fields of MyAppResourceSpec.
+const (
+	DefaultImageTag          = "latest"
+	DefaultCPURequest        = "100m"
+	DefaultMemoryLimit       = "64Mi"
+	DefaultRedisReplicaCount = int32(1)
+	DefaultRedisMode         = RedisModeStandalone
+	DefaultRedisHAReplicas   = int32(3)
+	DefaultSentinelReplicas  = int32(3)
+	DefaultRedisRepository   = "redis"
+	DefaultRedisTag          = "7.2"
+	DefaultRedisStorageSize  = "1Gi"
+	DefaultRedisAccessMode   = corev1.ReadWriteOnce
+	DefaultRedisSave         = "3600 1 300 100 60 10000"
+	DefaultRedisAddressEnv   = "PODINFO_CACHE_SERVER"
+	DefaultRedisPasswordEnv  = "REDIS_PASSWORD"
+	DefaultMinReplicas       = int32(1)
+	DefaultMaxUnavailable    = "25%"
+	DefaultTargetCPU         = int32(80)
+	DefaultServicePort       = int32(9898)
+	DefaultServiceType       = corev1.ServiceTypeClusterIP
+	DefaultIngressPath       = "/"
+	DefaultUIColor           = "34577c"
+	DefaultUIMessage         = "Hello from MyAppResource"
+	DefaultUIColorEnv        = "PODINFO_UI_COLOR"
+	DefaultUIMessageEnv      = "PODINFO_UI_MESSAGE"
+	DefaultLivenessPath      = "/healthz"
+	DefaultReadinessPath     = "/readyz"
+	DefaultProbePort         = "http"
+
+	// DefaultCanaryReadinessTimeout is how long canary pods may stay unready.
+	DefaultCanaryReadinessTimeout = 5 * time.Minute
+	// DefaultRollbackWindow is how long the previous version of a blue/green
+	// rollout is kept after a promotion.
+	DefaultRollbackWindow = 10 * time.Minute
+)
+
+var (
+	// appLivenessHandler and appReadinessHandler probe the health endpoints
+	// of podinfo on its HTTP port.
+	appLivenessHandler = corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{Path: DefaultLivenessPath, Port: intstr.FromString(DefaultProbePort)},
+	}
+	appReadinessHandler = corev1.ProbeHandler{
+		HTTPGet: &corev1.HTTPGetAction{Path: DefaultReadinessPath, Port: intstr.FromString(DefaultProbePort)},
+	}
+	// redisLivenessHandler and redisReadinessHandler ping Redis with the
+	// password from REDISCLI_AUTH. A Redis still loading its data is alive
+	// but not ready.
+	redisLivenessHandler = corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "redis-cli ping | grep -Eq 'PONG|LOADING'"}},
+	}
+	redisReadinessHandler = corev1.ProbeHandler{
+		Exec: &corev1.ExecAction{Command: []string{"sh", "-c", "redis-cli ping | grep -q PONG"}},
+	}
+)
+
+// savePattern matches RDB snapshot rules made of "<seconds> <changes>" pairs.
+var savePattern = regexp.MustCompile(`^[0-9]+ [0-9]+( [0-9]+ [0-9]+)*$`)
+
+// colorPattern matches a 3 or 6 digit hex color with an optional leading '#'.
+var colorPattern = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks
+func (r *MyAppResource) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-my-api-group-rama-angi-platform-v1beta1-myappresource,mutating=true,failurePolicy=fail,sideEffects=None,groups=my.api.group.rama.angi.platform,resources=myappresources,verbs=create;update,versions=v1beta1,name=mmyappresource.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Defaulter = &MyAppResource{}
+
+// Default implements webhook.Defaulter so a webhook will be registered for the type
+func (r *MyAppResource) Default() {
+	myappresourcelog.Info("default", "name", r.Name)
+
+	r.Spec.Default()
+}
+
+// Default sets the default values of unset fields. It backs the defaulting
+// webhook and is also applied by the controller to objects stored before the
+// webhook was installed.
+func (s *MyAppResourceSpec) Default() {
+	if s.Image.Tag == "" {
+		s.Image.Tag = DefaultImageTag
+	}
+	s.Resources.Default()
+	s.Probes.Default(appLivenessHandler, appReadinessHandler)
+	if s.MaxUnavailable == nil {
+		maxUnavailable := intstr.FromString(DefaultMaxUnavailable)
+		s.MaxUnavailable = &maxUnavailable
+	}
+	if s.Autoscaling != nil {
+		s.Autoscaling.Default()
+	}
+	if canary := s.Rollout.Canary; canary != nil && canary.ReadinessTimeout == nil {
+		canary.ReadinessTimeout = &metav1.Duration{Duration: DefaultCanaryReadinessTimeout}
+	}
+	if blueGreen := s.Rollout.BlueGreen; blueGreen != nil && blueGreen.RollbackWindow == nil {
+		blueGreen.RollbackWindow = &metav1.Duration{Duration: DefaultRollbackWindow}
+	}
+	// The replica count is only meaningful, and only allowed, while Redis is enabled.
+	if s.Redis.Enabled {
+		// Earlier versions ran standalone replicas as independent primaries, so
+		// a standalone Redis with more than one replica is moved to sentinel
+		// mode, where the replicas follow a single primary
+		if s.Redis.Mode != RedisModeSentinel && s.Redis.ReplicaCount != nil && *s.Redis.ReplicaCount > 1 {
+			s.Redis.Mode = RedisModeSentinel
+		}
+		if s.Redis.Mode == "" {
+			s.Redis.Mode = DefaultRedisMode
+		}
+		if s.Redis.ReplicaCount == nil {
+			replicas := DefaultRedisReplicaCount
+			if s.Redis.Mode == RedisModeSentinel {
+				replicas = DefaultRedisHAReplicas
+			}
+			s.Redis.ReplicaCount = &replicas
+		}
+		if s.Redis.Mode == RedisModeSentinel {
+			if s.Redis.Sentinel == nil {
+				s.Redis.Sentinel = &RedisSentinelSpec{}
+			}
+			s.Redis.Sentinel.Default()
+		}
+		if s.Redis.Image.Repository == "" {
+			s.Redis.Image.Repository = DefaultRedisRepository
+		}
+		if s.Redis.Image.Tag == "" {
+			s.Redis.Image.Tag = DefaultRedisTag
+		}
+		if s.Redis.AddressEnvName == "" {
+			s.Redis.AddressEnvName = DefaultRedisAddressEnv
+		}
+		if s.Redis.PasswordEnvName == "" {
+			s.Redis.PasswordEnvName = DefaultRedisPasswordEnv
+		}
+		if s.Redis.Persistence != nil {
+			s.Redis.Persistence.Default()
+		}
+		s.Redis.Probes.Default(redisLivenessHandler, redisReadinessHandler)
+	}
+	if s.PreDeleteHook != nil {
+		if s.PreDeleteHook.Image.Repository == "" {
+			s.PreDeleteHook.Image = s.Image
+		}
+		if s.PreDeleteHook.Image.Tag == "" {
+			s.PreDeleteHook.Image.Tag = DefaultImageTag
+		}
+	}
+	if s.Service.Port == 0 {
+		s.Service.Port = DefaultServicePort
+	}
+	if s.Service.Type == "" {
+		s.Service.Type = DefaultServiceType
+	}
+	if s.Ingress != nil && s.Ingress.Path == "" {
+		s.Ingress.Path = DefaultIngressPath
+	}
+	if s.UI.Color == "" {
+		s.UI.Color = DefaultUIColor
+	}
+	if s.UI.Message == "" {
+		s.UI.Message = DefaultUIMessage
+	}
+	if s.UI.ColorEnvName == "" {
+		s.UI.ColorEnvName = DefaultUIColorEnv
+	}
+	if s.UI.MessageEnvName == "" {
+		s.UI.MessageEnvName = DefaultUIMessageEnv
+	}
+}
+
+// Default adds the liveness and readiness probes when they are unset and fills
+// in each probe. A startup probe without an action waits for readiness.
+func (p *ProbesSpec) Default(liveness, readiness corev1.ProbeHandler) {
+	if p.Liveness == nil {
+		p.Liveness = &Probe{}
+	}
+	p.Liveness.Default(liveness)
+	if p.Readiness == nil {
+		p.Readiness = &Probe{}
+	}
+	p.Readiness.Default(readiness)
+	if p.Startup != nil {
+		p.Startup.Default(readiness)
+	}
+}
+
+// Default fills in the action when none is set and the fields Kubernetes
+// defaults, so the probe is written to the pod template as the API server
+// stores it.
+func (p *Probe) Default(handler corev1.ProbeHandler) {
+	if p.Disabled {
+		return
+	}
+	if p.Exec == nil && p.HTTPGet == nil && p.TCPSocket == nil && p.GRPC == nil {
+		p.ProbeHandler = *handler.DeepCopy()
+	}
+	if p.HTTPGet != nil {
+		if p.HTTPGet.Path == "" {
+			p.HTTPGet.Path = "/"
+		}
+		if p.HTTPGet.Scheme == "" {
+			p.HTTPGet.Scheme = corev1.URISchemeHTTP
+		}
+	}
+	if p.GRPC != nil && p.GRPC.Service == nil {
+		service := ""
+		p.GRPC.Service = &service
+	}
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = 1
+	}
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = 10
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = 1
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = 3
+	}
+}
+
+// Default fills in the minimum replicas and, when no target is set, the CPU
+// target of the HorizontalPodAutoscaler.
+func (a *AutoscalingSpec) Default() {
+	if a.MinReplicas == nil {
+		minReplicas := DefaultMinReplicas
+		a.MinReplicas = &minReplicas
+	}
+	if a.TargetCPUUtilizationPercentage == nil && a.TargetMemoryUtilizationPercentage == nil {
+		target := DefaultTargetCPU
+		a.TargetCPUUtilizationPercentage = &target
+	}
+}
+
+// Default fills in the number of Sentinels and a majority quorum.
+func (s *RedisSentinelSpec) Default() {
+	if s.Replicas == nil {
+		replicas := DefaultSentinelReplicas
+		s.Replicas = &replicas
+	}
+	if s.Quorum == nil {
+		quorum := *s.Replicas/2 + 1
+		s.Quorum = &quorum
+	}
+}
+
+// Default fills in the volume size and access mode and enables both AOF and
+// RDB persistence.
+func (p *RedisPersistenceSpec) Default() {
+	if p.Size == "" {
+		p.Size = DefaultRedisStorageSize
+	}
+	if p.AccessMode == "" {
+		p.AccessMode = DefaultRedisAccessMode
+	}
+	if p.AppendOnly == nil {
+		appendOnly := true
+		p.AppendOnly = &appendOnly
+	}
+	if p.Save == "" {
+		p.Save = DefaultRedisSave
+	}
+}
+
+// Default fills in the CPU request and the memory request and limit. A memory
+// request without a limit is left unbounded, and a limit without a request
+// reserves the whole limit, as Kubernetes itself does.
+func (r *ResourceRequirements) Default() {
+	if r.Requests.CPU == "" {
+		r.Requests.CPU = DefaultCPURequest
+	}
+	if r.Requests.Memory == "" && r.Limits.Memory == "" {
+		r.Limits.Memory = DefaultMemoryLimit
+	}
+	if r.Requests.Memory == "" {
+		r.Requests.Memory = r.Limits.Memory
+	}
+}
+
+//+kubebuilder:webhook:path=/validate-my-api-group-rama-angi-platform-v1beta1-myappresource,mutating=false,failurePolicy=fail,sideEffects=None,groups=my.api.group.rama.angi.platform,resources=myappresources,verbs=create;update,versions=v1beta1,name=vmyappresource.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &MyAppResource{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateCreate() (admission.Warnings, error) {
+	myappresourcelog.Info("validate create", "name", r.Name)
+
+	return nil, r.validateMyAppResource()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateUpdate(old runtime.Object) (admission.Warnings, error) {
+	myappresourcelog.Info("validate update", "name", r.Name)
+
+	// An update that leaves the spec as it is, such as the controller adding
+	// its finalizer, is allowed even when the stored spec is invalid; the
+	// controller reports that through the SpecInvalid condition instead
+	if oldResource, ok := old.(*MyAppResource); ok && sameSpec(&oldResource.Spec, &r.Spec) {
+		return nil, nil
+	}
+	// A resource that is being deleted only waits for its teardown, so a spec
+	// that has become invalid must not keep its finalizer from being removed
+	if !r.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	return nil, r.validateMyAppResource()
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *MyAppResource) ValidateDelete() (admission.Warnings, error) {
+	myappresourcelog.Info("validate delete", "name", r.Name)
+
+	// Deletion is always allowed.
+	return nil, nil
+}
+
+// sameSpec reports whether two specs are equal once defaulted. The defaulting
+// webhook fills in the new spec of an update, while the stored one may have
+// been written before it was installed.
+func sameSpec(old, updated *MyAppResourceSpec) bool {
+	old, updated = old.DeepCopy(), updated.DeepCopy()
+	old.Default()
+	updated.Default()
+	return equality.Semantic.DeepEqual(old, updated)
+}
+
+// validateMyAppResource returns an Invalid error listing every problem in the spec.
+func (r *MyAppResource) validateMyAppResource() error {
+	allErrs := validateMyAppResourceSpec(&r.Spec, field.NewPath("spec"))
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(
+		schema.GroupKind{Group: GroupVersion.Group, Kind: "MyAppResource"},
+		r.Name, allErrs)
+}
+
+// Validate returns every problem in a defaulted spec. The controller checks
+// specs with it as well, since objects stored before the validating webhook
+// was installed have never been checked.
+func (s *MyAppResourceSpec) Validate(fldPath *field.Path) field.ErrorList {
+	return validateMyAppResourceSpec(s, fldPath)
+}
+
+func validateMyAppResourceSpec(spec *MyAppResourceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if spec.ReplicaCount < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("replicaCount"), spec.ReplicaCount, "must be greater than or equal to 0"))
+	}
+
+	if autoscaling := spec.Autoscaling; autoscaling != nil {
+		autoscalingPath := fldPath.Child("autoscaling")
+		if autoscaling.MaxReplicas < 1 {
+			allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("maxReplicas"), autoscaling.MaxReplicas, "must be greater than 0"))
+		}
+		if min := autoscaling.MinReplicas; min != nil {
+			if *min < 1 {
+				allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("minReplicas"), *min, "must be greater than 0"))
+			} else if *min > autoscaling.MaxReplicas {
+				allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("minReplicas"), *min, "must not be greater than maxReplicas"))
+			}
+		}
+		if target := autoscaling.TargetCPUUtilizationPercentage; target != nil && *target < 1 {
+			allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("targetCPUUtilizationPercentage"), *target, "must be greater than 0"))
+		}
+		if target := autoscaling.TargetMemoryUtilizationPercentage; target != nil && *target < 1 {
+			allErrs = append(allErrs, field.Invalid(autoscalingPath.Child("targetMemoryUtilizationPercentage"), *target, "must be greater than 0"))
+		}
+	}
+	// Scaling down with nothing allowed to be unavailable would never finish
+	if maxUnavailable := spec.MaxUnavailable; maxUnavailable != nil {
+		maxUnavailablePath := fldPath.Child("maxUnavailable")
+		if maxUnavailable.Type == intstr.Int {
+			if maxUnavailable.IntVal < 1 {
+				allErrs = append(allErrs, field.Invalid(maxUnavailablePath, maxUnavailable.IntVal, "must be greater than 0"))
+			}
+		} else {
+			percent, err := strconv.Atoi(strings.TrimSuffix(maxUnavailable.StrVal, "%"))
+			if err != nil || !strings.HasSuffix(maxUnavailable.StrVal, "%") || percent < 1 || percent > 100 {
+				allErrs = append(allErrs, field.Invalid(maxUnavailablePath, maxUnavailable.StrVal, "must be a percentage between 1% and 100%"))
+			}
+		}
+	}
+
+	if spec.Image.Repository == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("image", "repository"), "an image repository is required"))
+	}
+
+	if canary := spec.Rollout.Canary; canary != nil {
+		canaryPath := fldPath.Child("rollout", "canary")
+		if len(canary.Steps) == 0 {
+			allErrs = append(allErrs, field.Required(canaryPath.Child("steps"), "at least one step is required"))
+		}
+		for i, step := range canary.Steps {
+			stepPath := canaryPath.Child("steps").Index(i)
+			if step.Weight < 1 || step.Weight > 100 {
+				allErrs = append(allErrs, field.Invalid(stepPath.Child("weight"), step.Weight, "must be between 1 and 100"))
+			}
+			if step.Pause != nil && step.Pause.Duration < 0 {
+				allErrs = append(allErrs, field.Invalid(stepPath.Child("pause"), step.Pause.Duration.String(), "must not be negative"))
+			}
+		}
+		if timeout := canary.ReadinessTimeout; timeout != nil && timeout.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(canaryPath.Child("readinessTimeout"), timeout.Duration.String(), "must be greater than 0"))
+		}
+	}
+	if blueGreen := spec.Rollout.BlueGreen; blueGreen != nil {
+		blueGreenPath := fldPath.Child("rollout", "blueGreen")
+		if spec.Rollout.Canary != nil {
+			allErrs = append(allErrs, field.Forbidden(blueGreenPath, "may not be set together with canary"))
+		}
+		if after := blueGreen.AutoPromoteAfter; after != nil && after.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(blueGreenPath.Child("autoPromoteAfter"), after.Duration.String(), "must not be negative"))
+		}
+		if window := blueGreen.RollbackWindow; window != nil && window.Duration < 0 {
+			allErrs = append(allErrs, field.Invalid(blueGreenPath.Child("rollbackWindow"), window.Duration.String(), "must not be negative"))
+		}
+	}
+
+	allErrs = append(allErrs, validateResourceRequirements(&spec.Resources, fldPath.Child("resources"))...)
+	allErrs = append(allErrs, validateProbes(&spec.Probes, fldPath.Child("probes"))...)
+
+	for i, secret := range spec.ImagePullSecrets {
+		if secret.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("imagePullSecrets").Index(i).Child("name"), "a secret name is required"))
+		}
+	}
+
+	if spec.UI.Color != "" && !colorPattern.MatchString(spec.UI.Color) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("ui", "color"), spec.UI.Color, "must be a hex color such as 34577c or #34577c"))
+	}
+
+	allErrs = append(allErrs, validateEnvNames(spec, fldPath)...)
+
+	servicePath := fldPath.Child("service")
+	if spec.Service.Port < 0 || spec.Service.Port > 65535 {
+		allErrs = append(allErrs, field.Invalid(servicePath.Child("port"), spec.Service.Port, "must be between 1 and 65535"))
+	}
+	allErrs = append(allErrs, apivalidation.ValidateAnnotations(spec.Service.Annotations, servicePath.Child("annotations"))...)
+
+	if ingress := spec.Ingress; ingress != nil {
+		ingressPath := fldPath.Child("ingress")
+		if ingress.Host != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(strings.TrimPrefix(ingress.Host, "*.")) {
+				allErrs = append(allErrs, field.Invalid(ingressPath.Child("host"), ingress.Host, msg))
+			}
+		}
+		if ingress.Path != "" && !strings.HasPrefix(ingress.Path, "/") {
+			allErrs = append(allErrs, field.Invalid(ingressPath.Child("path"), ingress.Path, "must be an absolute path"))
+		}
+		if ingress.TLSSecretName != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(ingress.TLSSecretName) {
+				allErrs = append(allErrs, field.Invalid(ingressPath.Child("tlsSecretName"), ingress.TLSSecretName, msg))
+			}
+		}
+	}
+
+	redisPath := fldPath.Child("redis")
+	if spec.Redis.ReplicaCount != nil {
+		switch replicas := *spec.Redis.ReplicaCount; {
+		case !spec.Redis.Enabled:
+			allErrs = append(allErrs, field.Forbidden(redisPath.Child("replicaCount"), "may only be set when redis is enabled"))
+		case replicas < 0:
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("replicaCount"), replicas, "must be greater than or equal to 0"))
+		case spec.Redis.Mode == RedisModeSentinel && replicas < 2:
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("replicaCount"), replicas, "must be at least 2 in sentinel mode so there is a replica to fail over to"))
+		case spec.Redis.Mode != RedisModeSentinel && replicas > 1:
+			allErrs = append(allErrs, field.Invalid(redisPath.Child("replicaCount"), replicas, "must be at most 1 in standalone mode, where every replica would be an independent primary; use sentinel mode to run replicas"))
+		}
+	}
+	allErrs = append(allErrs, validateResourceRequirements(&spec.Redis.Resources, redisPath.Child("resources"))...)
+	allErrs = append(allErrs, validateProbes(&spec.Redis.Probes, redisPath.Child("probes"))...)
+	if sentinel := spec.Redis.Sentinel; sentinel != nil {
+		sentinelPath := redisPath.Child("sentinel")
+		if spec.Redis.Mode != RedisModeSentinel {
+			allErrs = append(allErrs, field.Forbidden(sentinelPath, "may only be set in sentinel mode"))
+		}
+		if sentinel.Replicas != nil && *sentinel.Replicas < 1 {
+			allErrs = append(allErrs, field.Invalid(sentinelPath.Child("replicas"), *sentinel.Replicas, "must be greater than 0"))
+		}
+		if sentinel.Quorum != nil {
+			if *sentinel.Quorum < 1 {
+				allErrs = append(allErrs, field.Invalid(sentinelPath.Child("quorum"), *sentinel.Quorum, "must be greater than 0"))
+			} else if sentinel.Replicas != nil && *sentinel.Quorum > *sentinel.Replicas {
+				allErrs = append(allErrs, field.Invalid(sentinelPath.Child("quorum"), *sentinel.Quorum, "must not be greater than the number of sentinel replicas"))
+			}
+		}
+		allErrs = append(allErrs, validateResourceRequirements(&sentinel.Resources, sentinelPath.Child("resources"))...)
+	}
+	if persistence := spec.Redis.Persistence; persistence != nil {
+		persistencePath := redisPath.Child("persistence")
+		size, errs := validateQuantity(persistence.Size, persistencePath.Child("size"))
+		allErrs = append(allErrs, errs...)
+		if size != nil && size.IsZero() {
+			allErrs = append(allErrs, field.Invalid(persistencePath.Child("size"), persistence.Size, "must be greater than 0"))
+		}
+		if persistence.Save != "" && !savePattern.MatchString(persistence.Save) {
+			allErrs = append(allErrs, field.Invalid(persistencePath.Child("save"), persistence.Save, `must be "<seconds> <changes>" pairs such as "3600 1 300 100"`))
+		}
+	}
+
+	allErrs = append(allErrs, validateDisruptionBudget(&spec.Disruption.App, fldPath.Child("disruption", "app"))...)
+	allErrs = append(allErrs, validateDisruptionBudget(&spec.Disruption.Redis, fldPath.Child("disruption", "redis"))...)
+
+	if hook := spec.PreDeleteHook; hook != nil {
+		hookPath := fldPath.Child("preDeleteHook")
+		if hook.BackoffLimit != nil && *hook.BackoffLimit < 0 {
+			allErrs = append(allErrs, field.Invalid(hookPath.Child("backoffLimit"), *hook.BackoffLimit, "must be greater than or equal to 0"))
+		}
+		if hook.ActiveDeadlineSeconds != nil && *hook.ActiveDeadlineSeconds <= 0 {
+			allErrs = append(allErrs, field.Invalid(hookPath.Child("activeDeadlineSeconds"), *hook.ActiveDeadlineSeconds, "must be greater than 0"))
+		}
+	}
+
+	return allErrs
+}
+
+// validateEnvNames checks the names of the environment variables the spec is
+// passed to the app container as. Each must be a valid name used only once.
+func validateEnvNames(spec *MyAppResourceSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	envNames := []struct {
+		path *field.Path
+		name string
+	}{
+		{fldPath.Child("ui", "colorEnvName"), spec.UI.ColorEnvName},
+		{fldPath.Child("ui", "messageEnvName"), spec.UI.MessageEnvName},
+		{fldPath.Child("redis", "addressEnvName"), spec.Redis.AddressEnvName},
+		{fldPath.Child("redis", "passwordEnvName"), spec.Redis.PasswordEnvName},
+	}
+	seen := map[string]bool{}
+	for _, env := range envNames {
+		if env.name == "" {
+			continue
+		}
+		for _, msg := range validation.IsEnvVarName(env.name) {
+			allErrs = append(allErrs, field.Invalid(env.path, env.name, msg))
+		}
+		if seen[env.name] {
+			allErrs = append(allErrs, field.Duplicate(env.path, env.name))
+		}
+		seen[env.name] = true
+	}
+	return allErrs
+}
+
+// validateDisruptionBudget checks that at most one bound is set and that it
+// is a non-negative number or a percentage.
+func validateDisruptionBudget(budget *DisruptionBudget, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("maxUnavailable"), "may not be set together with minAvailable"))
+	}
+	bounds := []struct {
+		path  *field.Path
+		value *intstr.IntOrString
+	}{
+		{fldPath.Child("minAvailable"), budget.MinAvailable},
+		{fldPath.Child("maxUnavailable"), budget.MaxUnavailable},
+	}
+	for _, bound := range bounds {
+		switch value := bound.value; {
+		case value == nil:
+		case value.Type == intstr.Int:
+			if value.IntVal < 0 {
+				allErrs = append(allErrs, field.Invalid(bound.path, value.IntVal, "must be greater than or equal to 0"))
+			}
+		default:
+			percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+			if err != nil || !strings.HasSuffix(value.StrVal, "%") || percent < 0 || percent > 100 {
+				allErrs = append(allErrs, field.Invalid(bound.path, value.StrVal, "must be a percentage between 0% and 100%"))
+			}
+		}
+	}
+	return allErrs
+}
+
+// validateProbes checks the probes of a container. Liveness and startup
+// probes must succeed once, as Kubernetes requires.
+func validateProbes(probes *ProbesSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateProbe(probes.Liveness, fldPath.Child("liveness"), true)...)
+	allErrs = append(allErrs, validateProbe(probes.Readiness, fldPath.Child("readiness"), false)...)
+	allErrs = append(allErrs, validateProbe(probes.Startup, fldPath.Child("startup"), true)...)
+	return allErrs
+}
+
+// validateProbe checks that a probe has a single action probing a valid port
+// and positive thresholds.
+func validateProbe(probe *Probe, fldPath *field.Path, singleSuccess bool) field.ErrorList {
+	var allErrs field.ErrorList
+	if probe == nil || probe.Disabled {
+		return allErrs
+	}
+
+	var handlers int
+	if exec := probe.Exec; exec != nil {
+		handlers++
+		if len(exec.Command) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("exec", "command"), "a command is required"))
+		}
+	}
+	if httpGet := probe.HTTPGet; httpGet != nil {
+		handlers++
+		allErrs = append(allErrs, validateProbePort(httpGet.Port, fldPath.Child("httpGet", "port"))...)
+	}
+	if tcpSocket := probe.TCPSocket; tcpSocket != nil {
+		handlers++
+		allErrs = append(allErrs, validateProbePort(tcpSocket.Port, fldPath.Child("tcpSocket", "port"))...)
+	}
+	if grpc := probe.GRPC; grpc != nil {
+		handlers++
+		for _, msg := range validation.IsValidPortNum(int(grpc.Port)) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("grpc", "port"), grpc.Port, msg))
+		}
+	}
+	if handlers > 1 {
+		allErrs = append(allErrs, field.Forbidden(fldPath, "may not specify more than one of exec, httpGet, tcpSocket and grpc"))
+	}
+
+	if probe.InitialDelaySeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("initialDelaySeconds"), probe.InitialDelaySeconds, "must be greater than or equal to 0"))
+	}
+	thresholds := []struct {
+		path  *field.Path
+		value int32
+	}{
+		{fldPath.Child("timeoutSeconds"), probe.TimeoutSeconds},
+		{fldPath.Child("periodSeconds"), probe.PeriodSeconds},
+		{fldPath.Child("successThreshold"), probe.SuccessThreshold},
+		{fldPath.Child("failureThreshold"), probe.FailureThreshold},
+	}
+	for _, threshold := range thresholds {
+		if threshold.value < 0 {
+			allErrs = append(allErrs, field.Invalid(threshold.path, threshold.value, "must be greater than 0"))
+		}
+	}
+	if singleSuccess && probe.SuccessThreshold > 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("successThreshold"), probe.SuccessThreshold, "must be 1"))
+	}
+	return allErrs
+}
+
+// validateProbePort checks a port given by number or by container port name.
+func validateProbePort(port intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	var msgs []string
+	if port.Type == intstr.Int {
+		msgs = validation.IsValidPortNum(port.IntValue())
+	} else {
+		msgs = validation.IsValidPortName(port.StrVal)
+	}
+	for _, msg := range msgs {
+		allErrs = append(allErrs, field.Invalid(fldPath, port.String(), msg))
+	}
+	return allErrs
+}
+
+// validateResourceRequirements checks every quantity and that no request exceeds its limit.
+func validateResourceRequirements(r *ResourceRequirements, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+
+	requestsPath := fldPath.Child("requests")
+	limitsPath := fldPath.Child("limits")
+	cpuRequest, errs := validateQuantity(r.Requests.CPU, requestsPath.Child("cpu"))
+	allErrs = append(allErrs, errs...)
+	memoryRequest, errs := validateQuantity(r.Requests.Memory, requestsPath.Child("memory"))
+	allErrs = append(allErrs, errs...)
+	cpuLimit, errs := validateQuantity(r.Limits.CPU, limitsPath.Child("cpu"))
+	allErrs = append(allErrs, errs...)
+	memoryLimit, errs := validateQuantity(r.Limits.Memory, limitsPath.Child("memory"))
+	allErrs = append(allErrs, errs...)
+
+	if cpuRequest != nil && cpuLimit != nil && cpuRequest.Cmp(*cpuLimit) > 0 {
+		allErrs = append(allErrs, field.Invalid(requestsPath.Child("cpu"), r.Requests.CPU, "must be less than or equal to the cpu limit"))
+	}
+	if memoryRequest != nil && memoryLimit != nil && memoryRequest.Cmp(*memoryLimit) > 0 {
+		allErrs = append(allErrs, field.Invalid(requestsPath.Child("memory"), r.Requests.Memory, "must be less than or equal to the memory limit"))
+	}
+
+	return allErrs
+}
+
+// validateQuantity checks that a non-empty value parses as a non-negative
+// resource quantity and returns the parsed quantity when it does.
+func validateQuantity(value string, fldPath *field.Path) (*resource.Quantity, field.ErrorList) {
+	if value == "" {
+		return nil, nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return nil, field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	if quantity.Sign() < 0 {
+		return nil, field.ErrorList{field.Invalid(fldPath, value, "must be greater than or equal to 0")}
+	}
+	return &quantity, nil
+}
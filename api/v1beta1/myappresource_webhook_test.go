@@ -0,0 +1,653 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// causeFields returns the field paths reported in an Invalid error.
+func causeFields(err error) []string {
+	statusErr, ok := err.(*apierrors.StatusError)
+	Expect(ok).To(BeTrue())
+	var fields []string
+	for _, cause := range statusErr.ErrStatus.Details.Causes {
+		fields = append(fields, cause.Field)
+	}
+	return fields
+}
+
+// storeWithoutValidation creates obj with the validating webhook removed, the
+// way objects were stored before the webhook was installed or one of its rules
+// was tightened.
+func storeWithoutValidation(obj *MyAppResource) {
+	configuration := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+	Expect(k8sClient.Get(ctx, client.ObjectKey{Name: "validating-webhook-configuration"}, configuration)).To(Succeed())
+	Expect(k8sClient.Delete(ctx, configuration)).To(Succeed())
+
+	// The API server keeps calling the webhook until it sees the deletion
+	Eventually(func() error {
+		return k8sClient.Create(ctx, obj)
+	}).Should(Succeed())
+
+	configuration.ResourceVersion = ""
+	Expect(k8sClient.Create(ctx, configuration)).To(Succeed())
+	Eventually(func() bool {
+		probe := obj.DeepCopy()
+		probe.ObjectMeta = metav1.ObjectMeta{Name: obj.Name + "-probe", Namespace: obj.Namespace}
+		return apierrors.IsInvalid(k8sClient.Create(ctx, probe, client.DryRunAll))
+	}).Should(BeTrue())
+}
+
+var _ = Describe("MyAppResource Webhook", func() {
+	var myAppResource *MyAppResource
+
+	BeforeEach(func() {
+		myAppResource = &MyAppResource{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "webhook-test",
+				Namespace: "default",
+			},
+			Spec: MyAppResourceSpec{
+				ReplicaCount:   2,
+				MaxUnavailable: ptr.To(intstr.FromInt32(1)),
+				Resources: ResourceRequirements{
+					Requests: ResourceList{CPU: "100m", Memory: "64Mi"},
+					Limits:   ResourceList{Memory: "64Mi"},
+				},
+				Probes: ProbesSpec{
+					Liveness:  &Probe{Disabled: true},
+					Readiness: &Probe{Disabled: true},
+				},
+				Image: ImageSpec{
+					Repository: "ghcr.io/stefanprodan/podinfo",
+					Tag:        "latest",
+				},
+				UI: UserInterface{
+					Color:          "34577c",
+					Message:        "Hey there",
+					ColorEnvName:   "PODINFO_UI_COLOR",
+					MessageEnvName: "PODINFO_UI_MESSAGE",
+				},
+				Service: ServiceSpec{Port: 80, Type: corev1.ServiceTypeLoadBalancer},
+				Redis: RedisSpec{
+					Enabled:         true,
+					Mode:            RedisModeStandalone,
+					Image:           ImageSpec{Repository: "redis", Tag: "7.2"},
+					AddressEnvName:  "REDIS_URL",
+					PasswordEnvName: "REDIS_AUTH",
+					Probes: ProbesSpec{
+						Liveness:  &Probe{Disabled: true},
+						Readiness: &Probe{Disabled: true},
+					},
+				},
+			},
+		}
+	})
+
+	Context("When creating MyAppResource under Defaulting Webhook", func() {
+		It("Should fill in the defaults for unset fields", func() {
+			myAppResource.Spec = MyAppResourceSpec{
+				ReplicaCount: 1,
+				Image:        ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo"},
+				Redis:        RedisSpec{Enabled: true},
+			}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Image.Tag).To(Equal(DefaultImageTag))
+			Expect(myAppResource.Spec.MaxUnavailable).To(Equal(ptr.To(intstr.FromString(DefaultMaxUnavailable))))
+			Expect(myAppResource.Spec.Resources.Requests.CPU).To(Equal(DefaultCPURequest))
+			Expect(myAppResource.Spec.Resources.Requests.Memory).To(Equal(DefaultMemoryLimit))
+			Expect(myAppResource.Spec.Resources.Limits.Memory).To(Equal(DefaultMemoryLimit))
+			Expect(myAppResource.Spec.Redis.ReplicaCount).To(Equal(ptr.To(DefaultRedisReplicaCount)))
+			Expect(myAppResource.Spec.Redis.Image.Repository).To(Equal(DefaultRedisRepository))
+			Expect(myAppResource.Spec.Redis.Image.Tag).To(Equal(DefaultRedisTag))
+			Expect(myAppResource.Spec.Redis.AddressEnvName).To(Equal(DefaultRedisAddressEnv))
+			Expect(myAppResource.Spec.Redis.PasswordEnvName).To(Equal(DefaultRedisPasswordEnv))
+			Expect(myAppResource.Spec.Redis.Mode).To(Equal(RedisModeStandalone))
+			Expect(myAppResource.Spec.Redis.Sentinel).To(BeNil())
+			Expect(myAppResource.Spec.Service.Port).To(Equal(DefaultServicePort))
+			Expect(myAppResource.Spec.Service.Type).To(Equal(DefaultServiceType))
+			Expect(myAppResource.Spec.Ingress).To(BeNil())
+			Expect(myAppResource.Spec.UI.Color).To(Equal(DefaultUIColor))
+			Expect(myAppResource.Spec.UI.Message).To(Equal(DefaultUIMessage))
+			Expect(myAppResource.Spec.UI.ColorEnvName).To(Equal(DefaultUIColorEnv))
+			Expect(myAppResource.Spec.UI.MessageEnvName).To(Equal(DefaultUIMessageEnv))
+
+			probes := myAppResource.Spec.Probes
+			Expect(probes.Liveness.HTTPGet).To(Equal(&corev1.HTTPGetAction{
+				Path:   DefaultLivenessPath,
+				Port:   intstr.FromString(DefaultProbePort),
+				Scheme: corev1.URISchemeHTTP,
+			}))
+			Expect(probes.Readiness.HTTPGet.Path).To(Equal(DefaultReadinessPath))
+			Expect(probes.Readiness.PeriodSeconds).To(Equal(int32(10)))
+			Expect(probes.Startup).To(BeNil())
+			redisProbes := myAppResource.Spec.Redis.Probes
+			Expect(redisProbes.Liveness.Exec.Command).To(ContainElement(ContainSubstring("redis-cli ping")))
+			Expect(redisProbes.Readiness.Exec.Command).To(ContainElement(ContainSubstring("redis-cli ping")))
+		})
+
+		It("Should keep the default probe action when only the thresholds are set", func() {
+			myAppResource.Spec.Probes = ProbesSpec{
+				Liveness: &Probe{Probe: corev1.Probe{FailureThreshold: 6}},
+				Startup:  &Probe{Probe: corev1.Probe{PeriodSeconds: 5, FailureThreshold: 30}},
+			}
+
+			myAppResource.Default()
+
+			probes := myAppResource.Spec.Probes
+			Expect(probes.Liveness.HTTPGet.Path).To(Equal(DefaultLivenessPath))
+			Expect(probes.Liveness.FailureThreshold).To(Equal(int32(6)))
+			Expect(probes.Liveness.TimeoutSeconds).To(Equal(int32(1)))
+			Expect(probes.Readiness.HTTPGet.Path).To(Equal(DefaultReadinessPath))
+			// A startup probe waits for the app to become ready
+			Expect(probes.Startup.HTTPGet.Path).To(Equal(DefaultReadinessPath))
+			Expect(probes.Startup.PeriodSeconds).To(Equal(int32(5)))
+		})
+
+		It("Should keep the values set by the user", func() {
+			myAppResource.Spec.Redis.ReplicaCount = ptr.To(int32(0))
+			expected := myAppResource.Spec.DeepCopy()
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec).To(Equal(*expected))
+		})
+
+		It("Should move a standalone Redis with more than one replica to sentinel mode", func() {
+			myAppResource.Spec.Redis.ReplicaCount = ptr.To(int32(3))
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Redis.Mode).To(Equal(RedisModeSentinel))
+			Expect(myAppResource.Spec.Redis.ReplicaCount).To(Equal(ptr.To(int32(3))))
+			Expect(myAppResource.Spec.Redis.Sentinel).NotTo(BeNil())
+			_, err := myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should not default the Redis replica count or image while Redis is disabled", func() {
+			myAppResource.Spec.Redis = RedisSpec{Enabled: false}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Redis.ReplicaCount).To(BeNil())
+			Expect(myAppResource.Spec.Redis.Image).To(Equal(ImageSpec{}))
+		})
+
+		It("Should run three Redis replicas watched by three Sentinels in sentinel mode", func() {
+			myAppResource.Spec.Redis = RedisSpec{Enabled: true, Mode: RedisModeSentinel}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Redis.ReplicaCount).To(Equal(ptr.To(DefaultRedisHAReplicas)))
+			Expect(myAppResource.Spec.Redis.Sentinel).To(Equal(&RedisSentinelSpec{
+				Replicas: ptr.To(DefaultSentinelReplicas),
+				Quorum:   ptr.To(int32(2)),
+			}))
+		})
+
+		It("Should scale on CPU from a single replica by default", func() {
+			myAppResource.Spec.Autoscaling = &AutoscalingSpec{MaxReplicas: 5}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Autoscaling.MinReplicas).To(Equal(ptr.To(DefaultMinReplicas)))
+			Expect(myAppResource.Spec.Autoscaling.TargetCPUUtilizationPercentage).To(Equal(ptr.To(DefaultTargetCPU)))
+
+			// A memory target alone does not add a CPU target
+			myAppResource.Spec.Autoscaling = &AutoscalingSpec{MaxReplicas: 5, TargetMemoryUtilizationPercentage: ptr.To(int32(70))}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Autoscaling.TargetCPUUtilizationPercentage).To(BeNil())
+		})
+
+		It("Should give canary pods five minutes to become ready by default", func() {
+			myAppResource.Spec.Rollout.Canary = &CanaryStrategy{Steps: []CanaryStep{{Weight: 20}}}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Rollout.Canary.ReadinessTimeout).To(Equal(&metav1.Duration{Duration: DefaultCanaryReadinessTimeout}))
+		})
+
+		It("Should keep the previous blue/green version for ten minutes by default", func() {
+			myAppResource.Spec.Rollout.BlueGreen = &BlueGreenStrategy{}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Rollout.BlueGreen.RollbackWindow).To(Equal(&metav1.Duration{Duration: DefaultRollbackWindow}))
+			Expect(myAppResource.Spec.Rollout.BlueGreen.AutoPromoteAfter).To(BeNil())
+		})
+
+		It("Should route the whole site to the app by default", func() {
+			myAppResource.Spec.Ingress = &IngressSpec{Host: "podinfo.example.com"}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Ingress.Path).To(Equal(DefaultIngressPath))
+		})
+
+		It("Should enable AOF and RDB persistence on a ReadWriteOnce volume by default", func() {
+			myAppResource.Spec.Redis.Persistence = &RedisPersistenceSpec{}
+
+			myAppResource.Default()
+
+			persistence := myAppResource.Spec.Redis.Persistence
+			Expect(persistence.Size).To(Equal(DefaultRedisStorageSize))
+			Expect(persistence.AccessMode).To(Equal(DefaultRedisAccessMode))
+			Expect(persistence.AppendOnly).To(Equal(ptr.To(true)))
+			Expect(persistence.Save).To(Equal(DefaultRedisSave))
+		})
+
+		It("Should run the pre-delete hook with the application image by default", func() {
+			myAppResource.Spec.PreDeleteHook = &PreDeleteHookSpec{Command: []string{"sh", "-c", "echo bye"}}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.PreDeleteHook.Image).To(Equal(myAppResource.Spec.Image))
+		})
+
+		It("Should request the whole memory limit unless a request is set", func() {
+			myAppResource.Spec.Resources = ResourceRequirements{Limits: ResourceList{Memory: "256Mi"}}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Resources.Requests.Memory).To(Equal("256Mi"))
+
+			myAppResource.Spec.Resources = ResourceRequirements{Requests: ResourceList{Memory: "128Mi"}}
+
+			myAppResource.Default()
+
+			Expect(myAppResource.Spec.Resources.Requests.Memory).To(Equal("128Mi"))
+			Expect(myAppResource.Spec.Resources.Limits.Memory).To(BeEmpty())
+		})
+
+		It("Should persist the defaults through the API server", func() {
+			myAppResource.Name = "webhook-defaults"
+			myAppResource.Spec.Image.Tag = ""
+			myAppResource.Spec.UI = UserInterface{}
+
+			Expect(k8sClient.Create(ctx, myAppResource)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, myAppResource)
+
+			stored := &MyAppResource{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(myAppResource), stored)).To(Succeed())
+			Expect(stored.Spec.Image.Tag).To(Equal(DefaultImageTag))
+			Expect(stored.Spec.UI.Color).To(Equal(DefaultUIColor))
+			Expect(stored.Spec.Redis.ReplicaCount).To(Equal(ptr.To(DefaultRedisReplicaCount)))
+		})
+	})
+
+	Context("When creating MyAppResource under Validating Webhook", func() {
+		It("Should admit a valid spec", func() {
+			_, err := myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny malformed resource quantities", func() {
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			myAppResource.Spec.Resources.Limits.Memory = "-64Mi"
+			myAppResource.Spec.Redis.Resources.Limits.CPU = "one"
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf(
+				"spec.resources.requests.cpu",
+				"spec.resources.limits.memory",
+				"spec.redis.resources.limits.cpu",
+			))
+		})
+
+		It("Should deny requests above their limits", func() {
+			myAppResource.Spec.Resources.Requests.Memory = "128Mi"
+			myAppResource.Spec.Resources.Limits.CPU = "50m"
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.resources.requests.cpu", "spec.resources.requests.memory"))
+		})
+
+		It("Should deny a Redis address variable that is not a valid environment variable name", func() {
+			myAppResource.Spec.Redis.AddressEnvName = "1-REDIS"
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.addressEnvName"))
+		})
+
+		It("Should deny a Redis password variable that clashes with the address variable", func() {
+			myAppResource.Spec.Redis.PasswordEnvName = myAppResource.Spec.Redis.AddressEnvName
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.passwordEnvName"))
+		})
+
+		It("Should deny Sentinel settings outside sentinel mode", func() {
+			myAppResource.Spec.Redis.Sentinel = &RedisSentinelSpec{Replicas: ptr.To(int32(3))}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.sentinel"))
+		})
+
+		It("Should deny more than one Redis replica outside sentinel mode", func() {
+			myAppResource.Spec.Redis.ReplicaCount = ptr.To(int32(2))
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.replicaCount"))
+
+			myAppResource.Spec.Redis.Mode = RedisModeSentinel
+			_, err = myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny a quorum above the number of Sentinels and a single Redis replica in sentinel mode", func() {
+			myAppResource.Spec.Redis.Mode = RedisModeSentinel
+			myAppResource.Spec.Redis.ReplicaCount = ptr.To(int32(1))
+			myAppResource.Spec.Redis.Sentinel = &RedisSentinelSpec{Replicas: ptr.To(int32(3)), Quorum: ptr.To(int32(4))}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.replicaCount", "spec.redis.sentinel.quorum"))
+		})
+
+		It("Should deny autoscaling bounds that are out of order", func() {
+			myAppResource.Spec.Autoscaling = &AutoscalingSpec{
+				MinReplicas:                    ptr.To(int32(4)),
+				MaxReplicas:                    2,
+				TargetCPUUtilizationPercentage: ptr.To(int32(0)),
+			}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.autoscaling.minReplicas", "spec.autoscaling.targetCPUUtilizationPercentage"))
+		})
+
+		It("Should deny a max unavailable that would never let the app scale down", func() {
+			myAppResource.Spec.MaxUnavailable = ptr.To(intstr.FromInt32(0))
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.maxUnavailable"))
+
+			myAppResource.Spec.MaxUnavailable = ptr.To(intstr.FromString("0%"))
+			_, err = myAppResource.ValidateCreate()
+			Expect(causeFields(err)).To(ConsistOf("spec.maxUnavailable"))
+
+			myAppResource.Spec.MaxUnavailable = ptr.To(intstr.FromString("50%"))
+			_, err = myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny a disruption budget with both bounds or a malformed percentage", func() {
+			myAppResource.Spec.Disruption = DisruptionSpec{
+				App: DisruptionBudget{
+					MinAvailable:   ptr.To(intstr.FromInt32(1)),
+					MaxUnavailable: ptr.To(intstr.FromInt32(1)),
+				},
+				Redis: DisruptionBudget{MaxUnavailable: ptr.To(intstr.FromString("150%"))},
+			}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.disruption.app.maxUnavailable", "spec.disruption.redis.maxUnavailable"))
+		})
+
+		It("Should deny probes with two actions, an invalid port or a liveness success threshold above 1", func() {
+			myAppResource.Spec.Probes = ProbesSpec{
+				Liveness: &Probe{Probe: corev1.Probe{
+					ProbeHandler:     corev1.ProbeHandler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(9898)}},
+					SuccessThreshold: 2,
+				}},
+				Readiness: &Probe{Probe: corev1.Probe{
+					ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/readyz", Port: intstr.FromString("not_a_port")}},
+				}},
+			}
+			myAppResource.Spec.Redis.Probes.Startup = &Probe{Probe: corev1.Probe{ProbeHandler: corev1.ProbeHandler{
+				Exec:      &corev1.ExecAction{Command: []string{"redis-cli", "ping"}},
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt32(70000)},
+			}}}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf(
+				"spec.probes.liveness.successThreshold",
+				"spec.probes.readiness.httpGet.port",
+				"spec.redis.probes.startup.tcpSocket.port",
+				"spec.redis.probes.startup",
+			))
+		})
+
+		It("Should deny canary steps outside 1-100% and a negative pause or timeout", func() {
+			myAppResource.Spec.Rollout.Canary = &CanaryStrategy{
+				Steps: []CanaryStep{
+					{Weight: 0},
+					{Weight: 50, Pause: &metav1.Duration{Duration: -time.Minute}},
+					{Weight: 150},
+				},
+				ReadinessTimeout: &metav1.Duration{},
+			}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf(
+				"spec.rollout.canary.steps[0].weight",
+				"spec.rollout.canary.steps[1].pause",
+				"spec.rollout.canary.steps[2].weight",
+				"spec.rollout.canary.readinessTimeout",
+			))
+
+			myAppResource.Spec.Rollout.Canary = &CanaryStrategy{}
+			_, err = myAppResource.ValidateCreate()
+			Expect(causeFields(err)).To(ConsistOf("spec.rollout.canary.steps"))
+		})
+
+		It("Should deny a blue/green strategy with negative durations or next to a canary", func() {
+			myAppResource.Spec.Rollout.BlueGreen = &BlueGreenStrategy{
+				AutoPromoteAfter: &metav1.Duration{Duration: -time.Minute},
+				RollbackWindow:   &metav1.Duration{Duration: -time.Minute},
+			}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf(
+				"spec.rollout.blueGreen.autoPromoteAfter",
+				"spec.rollout.blueGreen.rollbackWindow",
+			))
+
+			myAppResource.Spec.Rollout.BlueGreen = &BlueGreenStrategy{}
+			myAppResource.Spec.Rollout.Canary = &CanaryStrategy{Steps: []CanaryStep{{Weight: 20}}}
+			_, err = myAppResource.ValidateCreate()
+			Expect(causeFields(err)).To(ConsistOf("spec.rollout.blueGreen"))
+		})
+
+		It("Should deny an invalid ingress host, path and TLS secret", func() {
+			myAppResource.Spec.Ingress = &IngressSpec{Host: "Podinfo_Example", Path: "podinfo", TLSSecretName: "TLS"}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.ingress.host", "spec.ingress.path", "spec.ingress.tlsSecretName"))
+
+			myAppResource.Spec.Ingress = &IngressSpec{Host: "*.example.com", Path: "/", TLSSecretName: "example-tls"}
+			_, err = myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny invalid Service annotations", func() {
+			myAppResource.Spec.Service.Annotations = map[string]string{"not a key": "value"}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.service.annotations"))
+		})
+
+		It("Should deny a UI variable that clashes with another app variable", func() {
+			myAppResource.Spec.UI.MessageEnvName = "REDIS_URL"
+			myAppResource.Spec.UI.ColorEnvName = "1COLOR"
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.ui.colorEnvName", "spec.redis.addressEnvName"))
+		})
+
+		It("Should deny an invalid Redis volume size and snapshot schedule", func() {
+			myAppResource.Spec.Redis.Persistence = &RedisPersistenceSpec{Size: "0", Save: "every hour"}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.persistence.size", "spec.redis.persistence.save"))
+		})
+
+		It("Should deny a negative pre-delete hook backoff limit", func() {
+			myAppResource.Spec.PreDeleteHook = &PreDeleteHookSpec{BackoffLimit: ptr.To(int32(-1))}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.preDeleteHook.backoffLimit"))
+		})
+
+		It("Should deny image pull secrets without a name", func() {
+			myAppResource.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}, {}}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.imagePullSecrets[1].name"))
+		})
+
+		It("Should deny an empty image repository and a negative replica count", func() {
+			myAppResource.Spec.Image.Repository = ""
+			myAppResource.Spec.ReplicaCount = -1
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.image.repository", "spec.replicaCount"))
+		})
+
+		It("Should deny a UI color that is not a hex string", func() {
+			myAppResource.Spec.UI.Color = "blue"
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.ui.color"))
+
+			myAppResource.Spec.UI.Color = "#34577c"
+			_, err = myAppResource.ValidateCreate()
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny a Redis replica count while Redis is disabled", func() {
+			myAppResource.Spec.Redis = RedisSpec{Enabled: false, ReplicaCount: ptr.To(int32(2))}
+
+			_, err := myAppResource.ValidateCreate()
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+			Expect(causeFields(err)).To(ConsistOf("spec.redis.replicaCount"))
+		})
+
+		It("Should reject invalid objects sent to the API server", func() {
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+
+			err := k8sClient.Create(ctx, myAppResource)
+			Expect(apierrors.IsInvalid(err) || apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.resources.requests.cpu"))
+		})
+	})
+
+	Context("When updating MyAppResource under Validating Webhook", func() {
+		It("Should validate the new spec", func() {
+			old := myAppResource.DeepCopy()
+			myAppResource.Spec.UI.Color = "#zzzzzz"
+
+			_, err := myAppResource.ValidateUpdate(old)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+
+		It("Should allow an update that leaves an invalid spec as it is", func() {
+			myAppResource.Spec.UI.Color = "#zzzzzz"
+			old := myAppResource.DeepCopy()
+			myAppResource.Finalizers = []string{"example.com/finalizer"}
+
+			_, err := myAppResource.ValidateUpdate(old)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Changing the spec still requires all of it to be valid
+			myAppResource.Spec.UI.Message = "Hello"
+			_, err = myAppResource.ValidateUpdate(old)
+			Expect(apierrors.IsInvalid(err)).To(BeTrue())
+		})
+
+		It("Should allow any update of a resource that is being deleted", func() {
+			myAppResource.Spec.UI.Color = "#zzzzzz"
+			old := myAppResource.DeepCopy()
+			myAppResource.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			myAppResource.Spec.UI.Message = "Goodbye"
+
+			_, err := myAppResource.ValidateUpdate(old)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should allow metadata updates of an invalid stored object through the API server", func() {
+			myAppResource.Name = "webhook-invalid-metadata"
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			storeWithoutValidation(myAppResource)
+			DeferCleanup(k8sClient.Delete, ctx, myAppResource)
+
+			patch := client.MergeFrom(myAppResource.DeepCopy())
+			myAppResource.Finalizers = []string{"example.com/finalizer"}
+			Expect(k8sClient.Patch(ctx, myAppResource, patch)).To(Succeed())
+			myAppResource.Finalizers = nil
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// Verify a change to the spec is still validated
+			myAppResource.Spec.UI.Message = "Hello"
+			err := k8sClient.Update(ctx, myAppResource)
+			Expect(apierrors.IsInvalid(err) || apierrors.IsForbidden(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("spec.resources.requests.cpu"))
+		})
+
+		It("Should release the finalizer of an invalid object deleted through the API server", func() {
+			myAppResource.Name = "webhook-invalid-delete"
+			myAppResource.Finalizers = []string{"example.com/finalizer"}
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			storeWithoutValidation(myAppResource)
+
+			Expect(k8sClient.Delete(ctx, myAppResource)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(myAppResource), myAppResource)).To(Succeed())
+			Expect(myAppResource.DeletionTimestamp).NotTo(BeNil())
+
+			patch := client.MergeFrom(myAppResource.DeepCopy())
+			myAppResource.Finalizers = nil
+			Expect(k8sClient.Patch(ctx, myAppResource, patch)).To(Succeed())
+			err := k8sClient.Get(ctx, client.ObjectKeyFromObject(myAppResource), myAppResource)
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+	})
+})
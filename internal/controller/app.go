@@ -0,0 +1,435 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	appsv1ac "k8s.io/client-go/applyconfigurations/apps/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+const (
+	// appContainerName is the name of the application container in the app pod template.
+	appContainerName = "app-container"
+	// appPort is the port podinfo serves HTTP on.
+	appPort = 9898
+)
+
+// appSelectorLabels returns the labels the app Deployment selects its pods by.
+func appSelectorLabels(myAppResource *myapigroupv1beta1.MyAppResource) map[string]string {
+	return selectorLabels(myAppResource, componentApp)
+}
+
+// containerProbe renders a probe from the spec, or nil when it is unset or
+// disabled. The spec has been defaulted, so the probe matches what the API
+// server stores.
+func containerProbe(probe *myapigroupv1beta1.Probe) *corev1.Probe {
+	if probe == nil || probe.Disabled {
+		return nil
+	}
+	return probe.Probe.DeepCopy()
+}
+
+// appEnv returns the environment of the app container, which carries the UI
+// settings and tells the app where to find Redis and how to authenticate when
+// it is enabled. Being part of the pod template, a change rolls the app.
+func appEnv(myAppResource *myapigroupv1beta1.MyAppResource) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	ui := myAppResource.Spec.UI
+	if ui.ColorEnvName != "" && ui.Color != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  ui.ColorEnvName,
+			Value: "#" + strings.TrimPrefix(ui.Color, "#"),
+		})
+	}
+	if ui.MessageEnvName != "" && ui.Message != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  ui.MessageEnvName,
+			Value: ui.Message,
+		})
+	}
+
+	redis := myAppResource.Spec.Redis
+	if !redis.Enabled {
+		return env
+	}
+	if redis.AddressEnvName != "" {
+		env = append(env, corev1.EnvVar{
+			Name:  redis.AddressEnvName,
+			Value: fmt.Sprintf("tcp://%s", redisEndpoint(myAppResource)),
+		})
+	}
+	if redis.PasswordEnvName != "" {
+		env = append(env, corev1.EnvVar{
+			Name:      redis.PasswordEnvName,
+			ValueFrom: redisPasswordEnvSource(myAppResource),
+		})
+	}
+	return env
+}
+
+// containerImageName returns the image reference of an ImageSpec.
+func containerImageName(image myapigroupv1beta1.ImageSpec) string {
+	return fmt.Sprintf("%s:%s", image.Repository, image.Tag)
+}
+
+// appRevisionAnnotation records on the app Deployment and the canary and
+// preview ReplicaSets the revision of the pod template they were written with.
+const appRevisionAnnotation = "my.api.group.rama.angi.platform/revision"
+
+// mutateAppPodTemplate writes the fields of the app pod template owned by the
+// controller.
+func mutateAppPodTemplate(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, template *corev1.PodTemplateSpec) {
+	spec := myAppResource.Spec
+
+	template.Labels = mergeStringMap(template.Labels, componentLabels(myAppResource, componentApp))
+
+	var container *corev1.Container
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == appContainerName {
+			container = &template.Spec.Containers[i]
+			break
+		}
+	}
+	if container == nil {
+		template.Spec.Containers = append(template.Spec.Containers, corev1.Container{Name: appContainerName})
+		container = &template.Spec.Containers[len(template.Spec.Containers)-1]
+	}
+	container.Image = containerImageName(spec.Image)
+	if spec.Image.PullPolicy != "" {
+		container.ImagePullPolicy = spec.Image.PullPolicy
+	}
+	container.Ports = []corev1.ContainerPort{
+		{Name: "http", ContainerPort: appPort, Protocol: corev1.ProtocolTCP},
+	}
+	container.Resources = desired.appResources
+	container.LivenessProbe = containerProbe(spec.Probes.Liveness)
+	container.ReadinessProbe = containerProbe(spec.Probes.Readiness)
+	container.StartupProbe = containerProbe(spec.Probes.Startup)
+	container.Env = appEnv(myAppResource)
+	template.Spec.ImagePullSecrets = spec.ImagePullSecrets
+}
+
+// appRevision returns a short hash of the app pod template rendered from the
+// spec. It changes with every change the Deployment would roll out.
+func appRevision(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (string, error) {
+	template := &corev1.PodTemplateSpec{}
+	mutateAppPodTemplate(myAppResource, desired, template)
+	data, err := json.Marshal(template)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10], nil
+}
+
+// reconcileAppDeployment applies the Deployment running the application.
+// Changes to the image or resources are written to the pod template so the
+// Deployment controller rolls them out, unless a canary or blue/green rollout
+// holds the Deployment on the stable revision. A new Redis password restarts
+// the app only once Redis has rolled out with it. Lowering the replicas
+// removes at most MaxUnavailable pods at a time, and a Deployment left with the
+// selector of an earlier controller version is replaced once its pods carry the
+// current labels, so it also reports whether a scale-down or a replacement is
+// still in progress.
+func (r *MyAppResourceReconciler) reconcileAppDeployment(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (*appsv1.Deployment, bool, error) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      myAppResource.Name,
+			Namespace: myAppResource.Namespace,
+		},
+	}
+
+	spec := myAppResource.Spec
+	selector := appSelectorLabels(myAppResource)
+	revision, err := appRevision(myAppResource, desired)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var authChecksum string
+	var redisAuthReady bool
+	if spec.Redis.Enabled {
+		authChecksum, redisAuthReady, err = r.appRedisAuth(ctx, myAppResource)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	terminating, err := r.terminatingAppPods(ctx, myAppResource)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var relabelling bool
+	current := &appsv1.Deployment{}
+	err = r.Get(ctx, client.ObjectKeyFromObject(deployment), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, false, err
+	}
+	found := err == nil
+	if found {
+		migration, err := r.migrateSelector(ctx, myAppResource, current, selector, deploymentRolledOut(current))
+		if err != nil {
+			return nil, false, err
+		}
+		if migration == selectorReplacing {
+			return current, true, nil
+		}
+		relabelling = migration == selectorRelabelling
+	}
+
+	// Without autoscaling the replicas follow the spec again, so they are
+	// taken back from the autoscaler
+	if found && spec.Autoscaling == nil {
+		if err := r.takeOverField(ctx, current, "scale", "spec", "replicas"); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var heldTemplate corev1.PodTemplateSpec
+	holdRevision := rolloutHoldsRevision(myAppResource) && found
+	if holdRevision {
+		if heldTemplate, err = appliedPodTemplate(current); err != nil {
+			return nil, false, err
+		}
+	}
+	var scalingDown bool
+	op, err := r.apply(ctx, myAppResource, deployment, func() error {
+		replicas := appReplicas(myAppResource, current)
+		if holdRevision && spec.Autoscaling == nil {
+			// A canary takes over part of the replicas, while a blue/green
+			// preview runs next to all of them
+			replicas = stableReplicas(replicas, canaryWeight(myAppResource))
+		}
+		if found && current.Spec.Replicas != nil && replicas < *current.Spec.Replicas {
+			// Take the next batch down only once the Deployment has scaled to
+			// the previous one and its pods are gone
+			scalingDown = true
+			next := *current.Spec.Replicas
+			if current.Status.ObservedGeneration >= current.Generation && current.Status.Replicas == next && terminating == 0 {
+				next -= scaleDownBatch(myAppResource, next)
+			}
+			if next > replicas {
+				replicas = next
+			}
+		}
+		// The replicas of an autoscaled Deployment are left to the autoscaler
+		// once it has set them
+		if spec.Autoscaling == nil || !managedByOthers(current, "spec", "replicas") {
+			deployment.Spec.Replicas = &replicas
+		}
+		deployment.Labels = componentLabels(myAppResource, componentApp)
+		// The selector is immutable, so an existing one is applied as it is
+		deployment.Spec.Selector = &metav1.LabelSelector{MatchLabels: selector}
+		if found {
+			deployment.Spec.Selector = current.Spec.Selector
+		}
+		// Only maxUnavailable is applied, so the maxSurge defaulted by the API
+		// server is kept
+		deployment.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+		deployment.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{MaxUnavailable: spec.MaxUnavailable}
+
+		template := &deployment.Spec.Template
+		if holdRevision {
+			*template = heldTemplate
+			if held, ok := current.Annotations[appRevisionAnnotation]; ok {
+				deployment.Annotations = map[string]string{appRevisionAnnotation: held}
+			}
+		} else {
+			deployment.Annotations = map[string]string{appRevisionAnnotation: revision}
+			mutateAppPodTemplate(myAppResource, desired, template)
+			template.Labels[appRevisionLabel] = revision
+		}
+		// A stale selector still needs its labels on the pods
+		if deployment.Spec.Selector != nil {
+			template.Labels = mergeStringMap(template.Labels, deployment.Spec.Selector.MatchLabels)
+		}
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		switch {
+		case authChecksum == "":
+			delete(template.Annotations, redisAuthChecksumAnnotation)
+		case redisAuthReady || !found:
+			// New pods read the current password, so a new Deployment does not
+			// have to wait for Redis
+			template.Annotations[redisAuthChecksumAnnotation] = authChecksum
+		default:
+			if applied, ok := current.Spec.Template.Annotations[redisAuthChecksumAnnotation]; ok {
+				template.Annotations[redisAuthChecksumAnnotation] = applied
+			}
+		}
+
+		return ctrl.SetControllerReference(myAppResource, deployment, r.Scheme)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	r.recordCreated(myAppResource, deployment, op)
+	switch {
+	case op == controllerutil.OperationResultCreated:
+		recordScaledPods(myAppResource, componentApp, 0, *deployment.Spec.Replicas)
+	case op == controllerutil.OperationResultUpdated && current.Spec.Replicas != nil && *current.Spec.Replicas != *deployment.Spec.Replicas:
+		recordScaledPods(myAppResource, componentApp, *current.Spec.Replicas, *deployment.Spec.Replicas)
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventScaled,
+			fmt.Sprintf("Scaled Deployment %s from %d to %d replicas", deployment.Name, *current.Spec.Replicas, *deployment.Spec.Replicas))
+	}
+	return deployment, scalingDown || relabelling, nil
+}
+
+// appliedPodTemplate returns the pod template the controller last applied to
+// a Deployment, without the fields set by others or defaulted by the API
+// server. A Deployment the controller has not applied yet, as one written by
+// an earlier controller version, has its stored template returned as it is.
+func appliedPodTemplate(deployment *appsv1.Deployment) (corev1.PodTemplateSpec, error) {
+	applied, err := appsv1ac.ExtractDeployment(deployment, fieldManager)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+	if applied.Spec == nil || applied.Spec.Template == nil {
+		return *deployment.Spec.Template.DeepCopy(), nil
+	}
+	data, err := json.Marshal(applied.Spec.Template)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+	var template corev1.PodTemplateSpec
+	return template, json.Unmarshal(data, &template)
+}
+
+// scaleDownBatch returns how many app pods may be removed at once from the
+// current replicas, which is at least one.
+func scaleDownBatch(myAppResource *myapigroupv1beta1.MyAppResource, current int32) int32 {
+	maxUnavailable := intstr.FromString(myapigroupv1beta1.DefaultMaxUnavailable)
+	if myAppResource.Spec.MaxUnavailable != nil {
+		maxUnavailable = *myAppResource.Spec.MaxUnavailable
+	}
+	batch, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, int(current), true)
+	if err != nil || batch < 1 {
+		return 1
+	}
+	return int32(batch)
+}
+
+// terminatingAppPods counts the pods of the app Deployment that are shutting
+// down. The canary and preview pods share the app selector labels but are
+// told apart by their track, so they do not hold the scale-down of the
+// Deployment. The pods are read from the cache, so a scale-down can follow
+// them without polling the API server.
+func (r *MyAppResourceReconciler) terminatingAppPods(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (int32, error) {
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(myAppResource.Namespace), client.MatchingLabels(appSelectorLabels(myAppResource))); err != nil {
+		return 0, err
+	}
+	var terminating int32
+	for _, pod := range podList.Items {
+		if _, tracked := pod.Labels[canaryTrackLabel]; tracked {
+			continue
+		}
+		if !pod.DeletionTimestamp.IsZero() {
+			terminating++
+		}
+	}
+	return terminating, nil
+}
+
+// drainLegacyPods removes the bare pods created by earlier versions of the
+// controller. The pods keep serving until the Deployment has rolled out all of
+// its replicas, after which they are deleted. It reports whether legacy pods are
+// still present so the caller can check back.
+func (r *MyAppResourceReconciler) drainLegacyPods(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, deployment *appsv1.Deployment) (bool, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	// The pods were labelled before the current label scheme, so they are
+	// not in the cache
+	podList := &corev1.PodList{}
+	if err := r.apiReader().List(ctx, podList, client.InNamespace(myAppResource.Namespace), client.MatchingLabels{legacyLabelApp: myAppResource.Name}); err != nil {
+		return false, err
+	}
+
+	var legacyPods []corev1.Pod
+	for _, pod := range podList.Items {
+		// Pods managed by the Deployment are owned by a ReplicaSet; only pods
+		// directly controlled by the MyAppResource are left over from before.
+		if owner := metav1.GetControllerOf(&pod); owner != nil && owner.UID == myAppResource.UID {
+			legacyPods = append(legacyPods, pod)
+		}
+	}
+	if len(legacyPods) == 0 {
+		return false, nil
+	}
+
+	if !deploymentRolledOut(deployment) {
+		log.Info("Waiting for the app Deployment to become available before removing legacy pods", "legacyPods", len(legacyPods))
+		return true, nil
+	}
+
+	// Remove the pods in batches of MaxUnavailable, counting the ones still
+	// terminating from the previous batch
+	allowed := scaleDownBatch(myAppResource, int32(len(legacyPods)))
+	for _, pod := range legacyPods {
+		if !pod.DeletionTimestamp.IsZero() {
+			allowed--
+		}
+	}
+	for i := range legacyPods {
+		pod := &legacyPods[i]
+		if !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if allowed <= 0 {
+			break
+		}
+		allowed--
+		if err := r.Delete(ctx, pod); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to delete legacy pod", "Namespace", pod.Namespace, "Name", pod.Name)
+			return true, err
+		}
+		log.Info("Deleted legacy pod", "Namespace", pod.Namespace, "Name", pod.Name)
+		podsDeleted.WithLabelValues(myAppResource.Namespace, myAppResource.Name, componentApp).Inc()
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventLegacyPodDeleted, fmt.Sprintf("Deleted pod %s left by an earlier version of the controller", pod.Name))
+	}
+	return true, nil
+}
+
+// deploymentRolledOut reports whether the Deployment controller has observed the
+// latest spec and all desired replicas are updated and available.
+func deploymentRolledOut(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	desired := int32(1)
+	if deployment.Spec.Replicas != nil {
+		desired = *deployment.Spec.Replicas
+	}
+	return deployment.Status.UpdatedReplicas >= desired && deployment.Status.AvailableReplicas >= desired
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/csaupgrade"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// fieldManager is the field manager the controller applies its objects as.
+const fieldManager = "myappresource-controller"
+
+// legacyFieldManager is the field manager the API server recorded for the
+// create and update requests of earlier controller versions. Like the API
+// server, it is taken from the default user agent.
+var legacyFieldManager = strings.SplitN(rest.DefaultKubernetesUserAgent(), "/", 2)[0]
+
+// fieldConflictError reports an object the controller did not apply because
+// it would take over fields another field manager set to other values, or
+// because another controller controls it.
+type fieldConflictError struct {
+	kind string
+	name string
+	err  error
+}
+
+func (e *fieldConflictError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.kind, e.name, e.err)
+}
+
+func (e *fieldConflictError) Unwrap() error {
+	return e.err
+}
+
+// asFieldConflict returns the *fieldConflictError in the chain of err.
+func asFieldConflict(err error) (*fieldConflictError, bool) {
+	var conflict *fieldConflictError
+	return conflict, stderrors.As(err, &conflict)
+}
+
+// apply server-side applies the fields mutate sets on obj as the field manager
+// of the controller, and reports whether the object was created or updated.
+// obj starts out with only its name and namespace, so mutate sets every field
+// the controller manages: a field left out is given up, and removed unless
+// another manager set it too. Fields another manager set to other values are
+// not taken over, and an object controlled by someone else is not applied at
+// all; a *fieldConflictError is returned instead. obj holds the object as
+// stored once apply returns.
+func (r *MyAppResourceReconciler) apply(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, obj client.Object, mutate func() error) (controllerutil.OperationResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	existing, err := r.Scheme.New(gvk)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	current := existing.(client.Object)
+	err = r.getObject(ctx, client.ObjectKeyFromObject(obj), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return controllerutil.OperationResultNone, err
+	}
+	found := err == nil
+	if found {
+		// Objects controlled by someone else are left alone and reported as a
+		// conflict
+		if err := ctrl.SetControllerReference(myAppResource, current.DeepCopyObject().(client.Object), r.Scheme); err != nil {
+			var owned *controllerutil.AlreadyOwnedError
+			if stderrors.As(err, &owned) {
+				return controllerutil.OperationResultNone, &fieldConflictError{kind: gvk.Kind, name: obj.GetName(), err: err}
+			}
+			return controllerutil.OperationResultNone, err
+		}
+		if err := r.upgradeManagedFields(ctx, current); err != nil {
+			return controllerutil.OperationResultNone, err
+		}
+	}
+
+	if err := mutate(); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	if err := r.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager)); err != nil {
+		if errors.IsConflict(err) {
+			return controllerutil.OperationResultNone, &fieldConflictError{kind: gvk.Kind, name: obj.GetName(), err: err}
+		}
+		return controllerutil.OperationResultNone, err
+	}
+
+	switch {
+	case !found:
+		return controllerutil.OperationResultCreated, nil
+	case obj.GetResourceVersion() != current.GetResourceVersion():
+		return controllerutil.OperationResultUpdated, nil
+	}
+	return controllerutil.OperationResultNone, nil
+}
+
+// upgradeManagedFields hands the fields earlier controller versions wrote with
+// create and update requests over to the field manager of the controller, so
+// that applying them does not conflict with the controller itself.
+func (r *MyAppResourceReconciler) upgradeManagedFields(ctx context.Context, obj client.Object) error {
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(obj, sets.New(legacyFieldManager), fieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	ctrl.Log.Info("Moving fields written by earlier controller versions to the field manager of the controller", "Kind", r.objectKind(obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+	return r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// takeOverField removes the field at path from the managers other than the
+// controller that set it through subresource, such as an autoscaler writing
+// the replicas through the scale subresource, so that the controller can
+// apply the field again without a conflict.
+func (r *MyAppResourceReconciler) takeOverField(ctx context.Context, obj client.Object, subresource string, path ...string) error {
+	entries := obj.GetManagedFields()
+	var kept []metav1.ManagedFieldsEntry
+	changed := false
+	for _, entry := range entries {
+		if entry.Manager == fieldManager || entry.Subresource != subresource || entry.FieldsV1 == nil {
+			kept = append(kept, entry)
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			return err
+		}
+		if !removeField(fields, path) {
+			kept = append(kept, entry)
+			continue
+		}
+		changed = true
+		if len(fields) == 0 {
+			continue
+		}
+		raw, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		entry.FieldsV1 = &metav1.FieldsV1{Raw: raw}
+		kept = append(kept, entry)
+	}
+	if !changed {
+		return nil
+	}
+
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": "/metadata/resourceVersion", "value": obj.GetResourceVersion()},
+		{"op": "replace", "path": "/metadata/managedFields", "value": kept},
+	})
+	if err != nil {
+		return err
+	}
+	ctrl.Log.Info("Taking over a field set by another field manager", "Kind", r.objectKind(obj), "Namespace", obj.GetNamespace(), "Name", obj.GetName(), "field", strings.Join(path, "."))
+	return r.Patch(ctx, obj, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// removeField removes the field at path from a field set, along with the
+// parents it leaves empty, and reports whether it was there.
+func removeField(fields map[string]interface{}, path []string) bool {
+	key := "f:" + path[0]
+	if len(path) == 1 {
+		if _, ok := fields[key]; !ok {
+			return false
+		}
+		delete(fields, key)
+		return true
+	}
+	next, ok := fields[key].(map[string]interface{})
+	if !ok || !removeField(next, path[1:]) {
+		return false
+	}
+	if len(next) == 0 {
+		delete(fields, key)
+	}
+	return true
+}
+
+// managedByOthers reports whether a field manager other than the controller
+// manages the field at path, given as field names such as "spec", "replicas".
+func managedByOthers(obj client.Object, path ...string) bool {
+	for _, entry := range obj.GetManagedFields() {
+		if entry.Manager == fieldManager || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err != nil {
+			continue
+		}
+		found := true
+		for _, name := range path {
+			next, ok := fields["f:"+name].(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			fields = next
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
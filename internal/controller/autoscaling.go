@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// appAutoscalerName returns the name of the HorizontalPodAutoscaler of the app.
+func appAutoscalerName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return myAppResource.Name
+}
+
+// appReplicas returns the replicas to write to the app Deployment. With
+// autoscaling the HorizontalPodAutoscaler owns the replica count, so the
+// current one is kept and the spec only sizes a new Deployment, within the
+// bounds of the autoscaler.
+func appReplicas(myAppResource *myapigroupv1beta1.MyAppResource, deployment *appsv1.Deployment) int32 {
+	spec := myAppResource.Spec
+	autoscaling := spec.Autoscaling
+	if autoscaling == nil {
+		return spec.ReplicaCount
+	}
+	if deployment.ResourceVersion != "" && deployment.Spec.Replicas != nil {
+		return *deployment.Spec.Replicas
+	}
+
+	replicas := spec.ReplicaCount
+	if autoscaling.MinReplicas != nil && replicas < *autoscaling.MinReplicas {
+		replicas = *autoscaling.MinReplicas
+	}
+	if replicas > autoscaling.MaxReplicas {
+		replicas = autoscaling.MaxReplicas
+	}
+	return replicas
+}
+
+// utilizationMetric returns a metric scaling on the average utilization of a resource.
+func utilizationMetric(name corev1.ResourceName, percentage int32) autoscalingv2.MetricSpec {
+	return autoscalingv2.MetricSpec{
+		Type: autoscalingv2.ResourceMetricSourceType,
+		Resource: &autoscalingv2.ResourceMetricSource{
+			Name: name,
+			Target: autoscalingv2.MetricTarget{
+				Type:               autoscalingv2.UtilizationMetricType,
+				AverageUtilization: &percentage,
+			},
+		},
+	}
+}
+
+// reconcileAppAutoscaler applies the HorizontalPodAutoscaler of the
+// app Deployment, or removes it once autoscaling is turned off.
+func (r *MyAppResourceReconciler) reconcileAppAutoscaler(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appAutoscalerName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	spec := myAppResource.Spec.Autoscaling
+	if spec == nil {
+		_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{hpa})
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, hpa, func() error {
+		hpa.Labels = componentLabels(myAppResource, componentApp)
+		hpa.Spec.ScaleTargetRef = autoscalingv2.CrossVersionObjectReference{
+			APIVersion: appsv1.SchemeGroupVersion.String(),
+			Kind:       "Deployment",
+			Name:       myAppResource.Name,
+		}
+		hpa.Spec.MinReplicas = spec.MinReplicas
+		hpa.Spec.MaxReplicas = spec.MaxReplicas
+
+		var metrics []autoscalingv2.MetricSpec
+		if spec.TargetCPUUtilizationPercentage != nil {
+			metrics = append(metrics, utilizationMetric(corev1.ResourceCPU, *spec.TargetCPUUtilizationPercentage))
+		}
+		if spec.TargetMemoryUtilizationPercentage != nil {
+			metrics = append(metrics, utilizationMetric(corev1.ResourceMemory, *spec.TargetMemoryUtilizationPercentage))
+		}
+		hpa.Spec.Metrics = metrics
+		hpa.Spec.Behavior = spec.Behavior.DeepCopy()
+		return ctrl.SetControllerReference(myAppResource, hpa, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, hpa, op)
+	return nil
+}
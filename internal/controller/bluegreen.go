@@ -0,0 +1,213 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// Reasons used for the BlueGreen condition.
+const (
+	reasonPreviewStarting     = "PreviewStarting"
+	reasonAwaitingPromotion   = "AwaitingPromotion"
+	reasonRollbackWindow      = "RollbackWindow"
+	reasonBlueGreenPromoting  = "Promoting"
+	reasonBlueGreenPromoted   = "Promoted"
+	reasonBlueGreenRolledBack = "RolledBack"
+)
+
+// appPreviewName returns the name of the preview ReplicaSet and its Service.
+func appPreviewName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return myAppResource.Name + "-preview"
+}
+
+// previewSelectorLabels returns the labels the preview ReplicaSet selects its
+// pods by. Like the canary pods, the preview pods carry the app selector
+// labels, and the revision label keeps them out of the app Service until
+// they are promoted.
+func previewSelectorLabels(myAppResource *myapigroupv1beta1.MyAppResource) map[string]string {
+	labels := appSelectorLabels(myAppResource)
+	labels[canaryTrackLabel] = "preview"
+	return labels
+}
+
+// blueGreenRevisions returns the revision the app Service sends the traffic
+// to and the one the preview Service shows. Without a rollout in progress
+// both are the revision of the spec.
+func blueGreenRevisions(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (string, string, error) {
+	rollout := myAppResource.Status.Rollout
+	if rollout == nil {
+		revision, err := appRevision(myAppResource, desired)
+		return revision, revision, err
+	}
+	switch rollout.Phase {
+	case myapigroupv1beta1.RolloutPhasePromoted, myapigroupv1beta1.RolloutPhasePromoting:
+		return rollout.Revision, rollout.Revision, nil
+	default:
+		return rollout.StableRevision, rollout.Revision, nil
+	}
+}
+
+// appServiceSelector returns the selector of the app Service from the labels
+// the app pods are selected by. With a blue/green strategy it only selects the
+// pods of the active revision.
+func appServiceSelector(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, selector map[string]string) (map[string]string, error) {
+	if myAppResource.Spec.Rollout.BlueGreen == nil {
+		return selector, nil
+	}
+	active, _, err := blueGreenRevisions(myAppResource, desired)
+	if err != nil {
+		return nil, err
+	}
+	selector[appRevisionLabel] = active
+	return selector, nil
+}
+
+// previewEndpoint returns the in-cluster address of the preview Service.
+func previewEndpoint(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s:%d", serviceDomain(myAppResource, appPreviewName(myAppResource)), myAppResource.Spec.Service.Port)
+}
+
+// advanceBlueGreen runs a new app revision in the preview ReplicaSet with as
+// many replicas as the app. Once its pods are ready it is promoted by the
+// PromoteAnnotation or after the auto-promotion delay, which moves the app
+// Service over to it. The Deployment keeps the previous revision until the
+// rollback window has passed.
+func (r *MyAppResourceReconciler) advanceBlueGreen(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, deployment *appsv1.Deployment, revision string) (time.Duration, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+	blueGreen := myAppResource.Spec.Rollout.BlueGreen
+	rollout := myAppResource.Status.Rollout
+
+	replicas := rolloutTotalReplicas(myAppResource, deployment)
+	current, err := r.reconcileRolloutReplicaSet(ctx, myAppResource, desired, appPreviewName(myAppResource), previewSelectorLabels(myAppResource), revision, replicas)
+	if err != nil {
+		return 0, err
+	}
+	if current == nil {
+		// The preview of an earlier revision is being replaced
+		return rolloutCheckInterval, nil
+	}
+	rollout.Replicas = myapigroupv1beta1.WorkloadStatus{
+		Replicas:        replicas,
+		ReadyReplicas:   current.Status.ReadyReplicas,
+		UpdatedReplicas: current.Status.Replicas,
+	}
+
+	now := metav1.Now()
+	if rollout.Phase == myapigroupv1beta1.RolloutPhasePromoted {
+		var window time.Duration
+		if blueGreen.RollbackWindow != nil {
+			window = blueGreen.RollbackWindow.Duration
+		}
+		if remaining := window - now.Sub(rollout.PromotedTime.Time); remaining > 0 {
+			setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonRollbackWindow,
+				fmt.Sprintf("Revision %s takes the traffic; revision %s is kept until %s to roll back to",
+					revision, rollout.StableRevision, rollout.PromotedTime.Add(window).UTC().Format(time.RFC3339)))
+			return remaining, nil
+		}
+		log.Info("Rollback window has passed, replacing the previous version", "revision", revision, "stableRevision", rollout.StableRevision)
+		rollout.Phase = myapigroupv1beta1.RolloutPhasePromoting
+		setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonBlueGreenPromoting, fmt.Sprintf("Rolling out revision %s to all replicas", revision))
+		return rolloutCheckInterval, nil
+	}
+
+	if current.Status.ObservedGeneration < current.Generation || current.Status.ReadyReplicas < replicas {
+		// The approval waits for the preview, and the auto-promotion delay
+		// starts over when its pods stop being ready
+		rollout.StepReadyTime = nil
+		setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonPreviewStarting,
+			fmt.Sprintf("%d/%d preview replicas of revision %s are ready", current.Status.ReadyReplicas, replicas, revision))
+		return rolloutCheckInterval, nil
+	}
+	if rollout.StepReadyTime == nil {
+		rollout.StepReadyTime = &now
+	}
+
+	approved := myAppResource.Annotations[myapigroupv1beta1.PromoteAnnotation] == revision
+	if !approved {
+		message := fmt.Sprintf("Revision %s is ready for review at %s; set the %s annotation to %s to promote it",
+			revision, previewEndpoint(myAppResource), myapigroupv1beta1.PromoteAnnotation, revision)
+		if blueGreen.AutoPromoteAfter == nil {
+			setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonAwaitingPromotion, message)
+			return 0, nil
+		}
+		promoteAt := rollout.StepReadyTime.Add(blueGreen.AutoPromoteAfter.Duration)
+		if remaining := promoteAt.Sub(now.Time); remaining > 0 {
+			setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonAwaitingPromotion,
+				fmt.Sprintf("%s, or it is promoted at %s", message, promoteAt.UTC().Format(time.RFC3339)))
+			return remaining, nil
+		}
+	}
+
+	log.Info("Promoting preview", "revision", revision, "approved", approved)
+	rollout.Phase = myapigroupv1beta1.RolloutPhasePromoted
+	rollout.PromotedTime = &now
+	return r.advanceBlueGreen(ctx, myAppResource, desired, deployment, revision)
+}
+
+// reconcileAppPreviewService applies the Service the preview of a
+// blue/green rollout is reached through, or removes it when the app has no
+// blue/green strategy. Without a rollout in progress it selects the current
+// version.
+func (r *MyAppResourceReconciler) reconcileAppPreviewService(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appPreviewName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	if myAppResource.Spec.Rollout.BlueGreen == nil {
+		_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{service})
+		return err
+	}
+	_, preview, err := blueGreenRevisions(myAppResource, desired)
+	if err != nil {
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, service, func() error {
+		service.Labels = componentLabels(myAppResource, componentApp)
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		service.Spec.Selector = appSelectorLabels(myAppResource)
+		service.Spec.Selector[appRevisionLabel] = preview
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       myAppResource.Spec.Service.Port,
+				TargetPort: intstr.FromString("http"),
+			},
+		}
+		return ctrl.SetControllerReference(myAppResource, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, service, op)
+	return nil
+}
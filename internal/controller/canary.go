@@ -0,0 +1,166 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// canaryTrackLabel tells the canary pods apart from the stable ones. The
+// canary pods carry the app selector labels too, so the app Service sends
+// them a share of the traffic in line with their share of the replicas.
+const canaryTrackLabel = "track"
+
+// Reasons used for the Canary condition.
+const (
+	reasonCanaryProgressing = "CanaryProgressing"
+	reasonCanaryPaused      = "CanaryPaused"
+	reasonCanaryPromoting   = "CanaryPromoting"
+	reasonCanaryPromoted    = "CanaryPromoted"
+	reasonCanaryAborted     = "CanaryAborted"
+	reasonCanaryReverted    = "CanaryReverted"
+)
+
+// appCanaryName returns the name of the canary ReplicaSet.
+func appCanaryName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return myAppResource.Name + "-canary"
+}
+
+// canarySelectorLabels returns the labels the canary ReplicaSet selects its pods by.
+func canarySelectorLabels(myAppResource *myapigroupv1beta1.MyAppResource) map[string]string {
+	labels := appSelectorLabels(myAppResource)
+	labels[canaryTrackLabel] = "canary"
+	return labels
+}
+
+// canaryWeight returns the weight of the current canary step, or 0 when no
+// canary is progressing.
+func canaryWeight(myAppResource *myapigroupv1beta1.MyAppResource) int32 {
+	rollout := myAppResource.Status.Rollout
+	canary := myAppResource.Spec.Rollout.Canary
+	if rollout == nil || canary == nil || rollout.Phase != myapigroupv1beta1.RolloutPhaseProgressing || int(rollout.Step) >= len(canary.Steps) {
+		return 0
+	}
+	return canary.Steps[rollout.Step].Weight
+}
+
+// canaryReplicas returns the replicas of the canary for a weight. It is
+// rounded up so that every step runs at least one canary pod.
+func canaryReplicas(total, weight int32) int32 {
+	return (total*weight + 99) / 100
+}
+
+// stableReplicas returns the replicas left to the stable version for a
+// weight. It is rounded up so that the app keeps its capacity while the
+// canary pods start.
+func stableReplicas(total, weight int32) int32 {
+	return total - total*weight/100
+}
+
+// advanceCanary moves a canary of a new app revision through the steps of the
+// spec. A canary whose pods stay unready past the readiness timeout is aborted.
+func (r *MyAppResourceReconciler) advanceCanary(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, deployment *appsv1.Deployment, revision string) (time.Duration, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+	canary := myAppResource.Spec.Rollout.Canary
+	rollout := myAppResource.Status.Rollout
+	stable := rollout.StableRevision
+
+	if rollout.Phase == myapigroupv1beta1.RolloutPhaseAborted {
+		if _, err := r.deleteControlledObjects(ctx, myAppResource, rolloutReplicaSets(myAppResource)); err != nil {
+			return 0, err
+		}
+		rollout.Replicas = myapigroupv1beta1.WorkloadStatus{}
+		return 0, nil
+	}
+
+	if int(rollout.Step) >= len(canary.Steps) {
+		// Steps were removed from the spec while the canary ran
+		rollout.Step = int32(len(canary.Steps)) - 1
+	}
+	step := canary.Steps[rollout.Step]
+	stepName := fmt.Sprintf("Step %d/%d (%d%%)", rollout.Step+1, len(canary.Steps), step.Weight)
+
+	replicas := canaryReplicas(rolloutTotalReplicas(myAppResource, deployment), step.Weight)
+	current, err := r.reconcileRolloutReplicaSet(ctx, myAppResource, desired, appCanaryName(myAppResource), canarySelectorLabels(myAppResource), revision, replicas)
+	if err != nil {
+		return 0, err
+	}
+	if current == nil {
+		// The canary of an earlier revision is being replaced
+		return rolloutCheckInterval, nil
+	}
+	rollout.Replicas = myapigroupv1beta1.WorkloadStatus{
+		Replicas:        replicas,
+		ReadyReplicas:   current.Status.ReadyReplicas,
+		UpdatedReplicas: current.Status.Replicas,
+	}
+
+	now := metav1.Now()
+	if current.Status.ObservedGeneration < current.Generation || current.Status.ReadyReplicas < replicas {
+		if rollout.UnreadySince == nil {
+			rollout.UnreadySince = &now
+		}
+		if now.Sub(rollout.UnreadySince.Time) > canary.ReadinessTimeout.Duration {
+			log.Info("Aborting canary whose pods are not ready", "revision", revision, "readyReplicas", current.Status.ReadyReplicas, "replicas", replicas)
+			message := fmt.Sprintf("Revision %s was aborted at step %d/%d: %d/%d canary replicas were not ready within %s; revision %s keeps running",
+				revision, rollout.Step+1, len(canary.Steps), current.Status.ReadyReplicas, replicas, canary.ReadinessTimeout.Duration, stable)
+			setRolloutCondition(myAppResource, metav1.ConditionFalse, reasonCanaryAborted, message)
+			rollout.Phase = myapigroupv1beta1.RolloutPhaseAborted
+			rollout.StepReadyTime = nil
+			rollout.UnreadySince = nil
+			rollout.Replicas = myapigroupv1beta1.WorkloadStatus{}
+			_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{current})
+			return 0, err
+		}
+		setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonCanaryProgressing,
+			fmt.Sprintf("%s: %d/%d canary replicas of revision %s are ready", stepName, current.Status.ReadyReplicas, replicas, revision))
+		return rolloutCheckInterval, nil
+	}
+
+	rollout.UnreadySince = nil
+	if rollout.StepReadyTime == nil {
+		rollout.StepReadyTime = &now
+	}
+	if step.Pause != nil {
+		if remaining := step.Pause.Duration - now.Sub(rollout.StepReadyTime.Time); remaining > 0 {
+			setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonCanaryPaused,
+				fmt.Sprintf("%s: revision %s is paused until %s", stepName, revision, rollout.StepReadyTime.Add(step.Pause.Duration).UTC().Format(time.RFC3339)))
+			return remaining, nil
+		}
+	}
+
+	rollout.Step++
+	rollout.StepReadyTime = nil
+	if int(rollout.Step) < len(canary.Steps) {
+		log.Info("Advancing canary", "revision", revision, "step", rollout.Step+1)
+		return r.advanceCanary(ctx, myAppResource, desired, deployment, revision)
+	}
+
+	log.Info("Promoting canary", "revision", revision)
+	rollout.Phase = myapigroupv1beta1.RolloutPhasePromoting
+	setRolloutCondition(myAppResource, metav1.ConditionTrue, reasonCanaryPromoting, fmt.Sprintf("Rolling out revision %s to all replicas", revision))
+	return rolloutCheckInterval, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// desiredState holds the values of the spec that are parsed before anything
+// is rendered. It is built by checkSpec, so the owned objects are rendered
+// from typed values and a quantity that does not parse marks the spec invalid
+// instead of being dropped.
+type desiredState struct {
+	// appResources are the compute resources of the app container.
+	appResources corev1.ResourceRequirements
+	// redisResources are the compute resources of the Redis container.
+	redisResources corev1.ResourceRequirements
+	// sentinelResources are the compute resources of the Sentinel container.
+	sentinelResources corev1.ResourceRequirements
+	// redisStorage is the size of the volume of each Redis replica. It is nil
+	// without persistence.
+	redisStorage *resource.Quantity
+}
+
+// newDesiredState parses the quantities of the defaulted spec.
+func newDesiredState(spec *myapigroupv1beta1.MyAppResourceSpec, path *field.Path) (*desiredState, field.ErrorList) {
+	desired := &desiredState{}
+	var allErrs field.ErrorList
+	var errs field.ErrorList
+
+	desired.appResources, errs = parseResourceRequirements(spec.Resources, path.Child("resources"))
+	allErrs = append(allErrs, errs...)
+
+	redisPath := path.Child("redis")
+	desired.redisResources, errs = parseResourceRequirements(spec.Redis.Resources, redisPath.Child("resources"))
+	allErrs = append(allErrs, errs...)
+	var sentinelResources myapigroupv1beta1.ResourceRequirements
+	if spec.Redis.Sentinel != nil {
+		sentinelResources = spec.Redis.Sentinel.Resources
+	}
+	desired.sentinelResources, errs = parseResourceRequirements(sentinelResources, redisPath.Child("sentinel", "resources"))
+	allErrs = append(allErrs, errs...)
+	if persistence := spec.Redis.Persistence; persistence != nil {
+		sizePath := redisPath.Child("persistence", "size")
+		size, err := resource.ParseQuantity(persistence.Size)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(sizePath, persistence.Size, err.Error()))
+		} else {
+			desired.redisStorage = &size
+		}
+	}
+	return desired, allErrs
+}
+
+// parseResourceRequirements parses the requests and limits of a container.
+func parseResourceRequirements(resources myapigroupv1beta1.ResourceRequirements, path *field.Path) (corev1.ResourceRequirements, field.ErrorList) {
+	requests, errs := parseResourceList(resources.Requests, path.Child("requests"))
+	limits, limitErrs := parseResourceList(resources.Limits, path.Child("limits"))
+	return corev1.ResourceRequirements{Requests: requests, Limits: limits}, append(errs, limitErrs...)
+}
+
+// parseResourceList parses the CPU and memory quantities that are set. An
+// empty quantity is left out of the list.
+func parseResourceList(list myapigroupv1beta1.ResourceList, path *field.Path) (corev1.ResourceList, field.ErrorList) {
+	result := corev1.ResourceList{}
+	var allErrs field.ErrorList
+	for _, quantity := range []struct {
+		name  corev1.ResourceName
+		value string
+	}{
+		{corev1.ResourceCPU, list.CPU},
+		{corev1.ResourceMemory, list.Memory},
+	} {
+		name, value := quantity.name, quantity.value
+		if value == "" {
+			continue
+		}
+		parsed, err := resource.ParseQuantity(value)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child(string(name)), value, err.Error()))
+			continue
+		}
+		result[name] = parsed
+	}
+	return result, allErrs
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// disruptionBudget is the desired PodDisruptionBudget of one workload. A nil
+// budget means the workload should have none.
+type disruptionBudget struct {
+	component      string
+	minAvailable   *intstr.IntOrString
+	maxUnavailable *intstr.IntOrString
+}
+
+// budgetBounds returns the bounds of a budget for a workload that runs up to
+// replicas pods, or false when the workload should have no budget. Unless the
+// spec sets a bound, one pod at a time may be evicted from a workload with more
+// than one replica, and a single replica is left without a budget so it does
+// not block node drains.
+func budgetBounds(budget myapigroupv1beta1.DisruptionBudget, replicas int32) (*intstr.IntOrString, *intstr.IntOrString, bool) {
+	switch {
+	case budget.Disabled:
+		return nil, nil, false
+	case budget.MinAvailable != nil || budget.MaxUnavailable != nil:
+		return budget.MinAvailable, budget.MaxUnavailable, true
+	case replicas > 1:
+		maxUnavailable := intstr.FromInt32(1)
+		return nil, &maxUnavailable, true
+	default:
+		return nil, nil, false
+	}
+}
+
+// appDisruptionBudget returns the budget of the app pods. With autoscaling the
+// app may grow to its maximum replicas, so the budget is sized for that.
+func appDisruptionBudget(myAppResource *myapigroupv1beta1.MyAppResource) *disruptionBudget {
+	spec := myAppResource.Spec
+	replicas := spec.ReplicaCount
+	if spec.Autoscaling != nil {
+		replicas = spec.Autoscaling.MaxReplicas
+	}
+	minAvailable, maxUnavailable, ok := budgetBounds(spec.Disruption.App, replicas)
+	if !ok {
+		return nil
+	}
+	return &disruptionBudget{
+		component:      componentApp,
+		minAvailable:   minAvailable,
+		maxUnavailable: maxUnavailable,
+	}
+}
+
+// redisDisruptionBudget returns the budget of the Redis pods.
+func redisDisruptionBudget(myAppResource *myapigroupv1beta1.MyAppResource) *disruptionBudget {
+	minAvailable, maxUnavailable, ok := budgetBounds(myAppResource.Spec.Disruption.Redis, redisReplicas(myAppResource))
+	if !ok {
+		return nil
+	}
+	return &disruptionBudget{
+		component:      componentRedis,
+		minAvailable:   minAvailable,
+		maxUnavailable: maxUnavailable,
+	}
+}
+
+// sentinelDisruptionBudget returns the budget of the Sentinels, which keeps
+// enough of them up to agree on a failover.
+func sentinelDisruptionBudget(myAppResource *myapigroupv1beta1.MyAppResource) *disruptionBudget {
+	if myAppResource.Spec.Disruption.Redis.Disabled {
+		return nil
+	}
+	replicas := redisSentinelReplicas(myAppResource)
+	quorum := replicas/2 + 1
+	if sentinel := myAppResource.Spec.Redis.Sentinel; sentinel != nil && sentinel.Quorum != nil {
+		quorum = *sentinel.Quorum
+	}
+	if quorum >= replicas {
+		// Keeping every Sentinel up would block node drains
+		return nil
+	}
+	minAvailable := intstr.FromInt32(quorum)
+	return &disruptionBudget{
+		component:    componentRedisSentinel,
+		minAvailable: &minAvailable,
+	}
+}
+
+// reconcileDisruptionBudget applies the named PodDisruptionBudget,
+// or removes it when budget is nil.
+func (r *MyAppResourceReconciler) reconcileDisruptionBudget(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, name string, budget *disruptionBudget) error {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	if budget == nil {
+		_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{pdb})
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, pdb, func() error {
+		pdb.Labels = componentLabels(myAppResource, budget.component)
+		pdb.Spec.Selector = &metav1.LabelSelector{MatchLabels: selectorLabels(myAppResource, budget.component)}
+		pdb.Spec.MinAvailable = budget.minAvailable
+		pdb.Spec.MaxUnavailable = budget.maxUnavailable
+		return ctrl.SetControllerReference(myAppResource, pdb, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, pdb, op)
+	return nil
+}
+
+// reconcileAppDisruptionBudget keeps the budget of the app pods in line with the spec.
+func (r *MyAppResourceReconciler) reconcileAppDisruptionBudget(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	return r.reconcileDisruptionBudget(ctx, myAppResource, myAppResource.Name, appDisruptionBudget(myAppResource))
+}
+
+// reconcileRedisDisruptionBudgets keeps the budgets of the Redis pods and, in
+// sentinel mode, of the Sentinels in line with the spec.
+func (r *MyAppResourceReconciler) reconcileRedisDisruptionBudgets(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	if err := r.reconcileDisruptionBudget(ctx, myAppResource, redisName(myAppResource), redisDisruptionBudget(myAppResource)); err != nil {
+		return err
+	}
+	if !redisSentinelMode(myAppResource) {
+		// The Sentinel budget is removed together with the Sentinels
+		return nil
+	}
+	return r.reconcileDisruptionBudget(ctx, myAppResource, redisSentinelName(myAppResource), sentinelDisruptionBudget(myAppResource))
+}
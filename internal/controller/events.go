@@ -0,0 +1,128 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// Reasons used for events that do not mirror a status condition.
+const (
+	eventCreated          = "Created"
+	eventDeleted          = "Deleted"
+	eventScaled           = "Scaled"
+	eventRecreating       = "Recreating"
+	eventPasswordRotated  = "RedisPasswordRotated"
+	eventRedisFailover    = "RedisFailover"
+	eventLegacyPodDeleted = "LegacyPodDeleted"
+)
+
+// Events are only recorded when something changes: an object is created or
+// deleted, a workload is scaled, or a condition moves to another status or
+// reason. Reconciles that find everything in place record nothing, and the
+// broadcaster of the manager aggregates similar events and rate limits them
+// per object, so a resource that keeps failing does not flood the API server.
+
+// recordEvent records an event on the MyAppResource when a recorder is set.
+func (r *MyAppResourceReconciler) recordEvent(myAppResource *myapigroupv1beta1.MyAppResource, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	r.Recorder.Event(myAppResource, eventType, reason, message)
+}
+
+// recordCreated records a Normal event when apply created obj.
+func (r *MyAppResourceReconciler) recordCreated(myAppResource *myapigroupv1beta1.MyAppResource, obj client.Object, op controllerutil.OperationResult) {
+	if op != controllerutil.OperationResultCreated {
+		return
+	}
+	r.recordEvent(myAppResource, corev1.EventTypeNormal, eventCreated, fmt.Sprintf("Created %s %s", r.objectKind(obj), obj.GetName()))
+}
+
+// objectKind returns the kind of obj for event messages.
+func (r *MyAppResourceReconciler) objectKind(obj client.Object) string {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return "object"
+	}
+	return gvk.Kind
+}
+
+// recordConditionEvents records an event for every condition that appeared
+// or changed its status or reason since original. The conditions every
+// resource carries are not announced when they first appear, unless they
+// report a problem. Conditions reporting a problem are recorded again when
+// their message changes, so that each new error shows up.
+func (r *MyAppResourceReconciler) recordConditionEvents(myAppResource *myapigroupv1beta1.MyAppResource, original []metav1.Condition) {
+	for _, condition := range myAppResource.Status.Conditions {
+		if condition.Type == myapigroupv1beta1.ConditionSpecInvalid || condition.Type == myapigroupv1beta1.ConditionFieldConflict {
+			// An invalid spec and field conflicts are reported through the
+			// Degraded condition
+			continue
+		}
+		warning := conditionIsWarning(condition)
+		previous := meta.FindStatusCondition(original, condition.Type)
+		switch {
+		case previous == nil:
+			if !warning && baselineCondition(condition.Type) {
+				continue
+			}
+		case previous.Status == condition.Status && previous.Reason == condition.Reason:
+			if !warning || previous.Message == condition.Message {
+				continue
+			}
+		}
+		eventType := corev1.EventTypeNormal
+		if warning {
+			eventType = corev1.EventTypeWarning
+		}
+		r.recordEvent(myAppResource, eventType, condition.Reason, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
+	}
+}
+
+// baselineCondition reports whether a condition is set on every resource from
+// its first reconcile.
+func baselineCondition(conditionType string) bool {
+	switch conditionType {
+	case myapigroupv1beta1.ConditionAvailable, myapigroupv1beta1.ConditionProgressing, myapigroupv1beta1.ConditionDegraded,
+		myapigroupv1beta1.ConditionRedisReady:
+		return true
+	}
+	return false
+}
+
+// conditionIsWarning reports whether a condition reports a problem that needs
+// attention, as opposed to progress.
+func conditionIsWarning(condition metav1.Condition) bool {
+	if condition.Type == myapigroupv1beta1.ConditionDegraded {
+		return condition.Status == metav1.ConditionTrue
+	}
+	switch condition.Reason {
+	case reasonCanaryAborted, reasonCanaryReverted, reasonBlueGreenRolledBack, reasonPreDeleteHookFailed:
+		return true
+	}
+	return false
+}
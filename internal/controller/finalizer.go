@@ -0,0 +1,372 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// myAppResourceFinalizer holds a deleted MyAppResource until its workloads
+// have been torn down in order.
+const myAppResourceFinalizer = "my.api.group.rama.angi.platform/finalizer"
+
+// Reasons used for the Terminating condition, one per teardown step.
+const (
+	reasonScalingDownApp       = "ScalingDownApp"
+	reasonTearingDownRedis     = "TearingDownRedis"
+	reasonRunningPreDeleteHook = "RunningPreDeleteHook"
+	reasonPreDeleteHookFailed  = "PreDeleteHookFailed"
+	reasonTeardownComplete     = "TeardownComplete"
+)
+
+// preDeleteHookContainerName is the name of the container in the pre-delete hook Job.
+const preDeleteHookContainerName = "pre-delete-hook"
+
+// preDeleteHookName returns the name of the pre-delete hook Job of a MyAppResource.
+func preDeleteHookName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-pre-delete", myAppResource.Name)
+}
+
+// ensureFinalizer adds the finalizer to a MyAppResource that does not carry it
+// yet. Only the finalizer is patched, through a copy, so that the in-memory
+// defaults and status are neither persisted nor replaced by the stored object.
+func (r *MyAppResourceReconciler) ensureFinalizer(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	if controllerutil.ContainsFinalizer(myAppResource, myAppResourceFinalizer) {
+		return nil
+	}
+	finalized := myAppResource.DeepCopy()
+	controllerutil.AddFinalizer(finalized, myAppResourceFinalizer)
+	if err := r.Patch(ctx, finalized, client.MergeFrom(myAppResource)); err != nil {
+		return err
+	}
+	myAppResource.Finalizers = finalized.Finalizers
+	myAppResource.ResourceVersion = finalized.ResourceVersion
+	return nil
+}
+
+// reconcileDelete tears down a deleted MyAppResource one step at a time: the
+// app is scaled to zero, Redis is scaled to zero and removed, and the optional
+// pre-delete hook is run. Each step is reported through the Terminating
+// condition, and the finalizer is released once all of them are done.
+func (r *MyAppResourceReconciler) reconcileDelete(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (ctrl.Result, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	if !controllerutil.ContainsFinalizer(myAppResource, myAppResourceFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	appDone, err := r.scaleDownApp(ctx, myAppResource)
+	if err != nil {
+		log.Error(err, "Failed to scale down app deployment")
+		return ctrl.Result{}, err
+	}
+	if !appDone {
+		return r.reportTeardown(ctx, myAppResource, reasonScalingDownApp, "Waiting for the app pods to terminate")
+	}
+
+	redisDone, err := r.teardownRedis(ctx, myAppResource)
+	if err != nil {
+		log.Error(err, "Failed to tear down Redis")
+		return ctrl.Result{}, err
+	}
+	if !redisDone {
+		return r.reportTeardown(ctx, myAppResource, reasonTearingDownRedis, "Waiting for the Redis pods to terminate")
+	}
+
+	if myAppResource.Spec.PreDeleteHook != nil {
+		job, err := r.reconcilePreDeleteHook(ctx, myAppResource)
+		if err != nil {
+			log.Error(err, "Failed to run pre-delete hook")
+			return ctrl.Result{}, err
+		}
+		if jobFailed(job) {
+			// The finalizer is kept so the hook can be fixed and retried by
+			// deleting the Job, or skipped by removing spec.preDeleteHook.
+			message := fmt.Sprintf("Job %s failed; delete it to retry or remove spec.preDeleteHook to skip it", job.Name)
+			return r.reportTeardown(ctx, myAppResource, reasonPreDeleteHookFailed, message)
+		}
+		if !jobComplete(job) {
+			return r.reportTeardown(ctx, myAppResource, reasonRunningPreDeleteHook, fmt.Sprintf("Waiting for Job %s to complete", job.Name))
+		}
+	}
+
+	if _, err := r.reportTeardown(ctx, myAppResource, reasonTeardownComplete, "All resources are torn down"); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Releasing finalizer", "Namespace", myAppResource.Namespace, "Name", myAppResource.Name)
+	patch := client.MergeFrom(myAppResource.DeepCopy())
+	controllerutil.RemoveFinalizer(myAppResource, myAppResourceFinalizer)
+	if err := r.Patch(ctx, myAppResource, patch); err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to remove finalizer")
+		return ctrl.Result{}, err
+	}
+	deleteMetrics(myAppResource.Namespace, myAppResource.Name)
+	return ctrl.Result{}, nil
+}
+
+// scaleDownApp scales the app Deployment and the canary and preview
+// ReplicaSets to zero and reports whether all of their pods are gone. The autoscaler is removed first
+// so it does not scale the app back up.
+func (r *MyAppResourceReconciler) scaleDownApp(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (bool, error) {
+	hpa := &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: myAppResource.Namespace, Name: appAutoscalerName(myAppResource)},
+	}
+	if err := r.Delete(ctx, hpa); err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	replicaSetsDone := true
+	for _, name := range []string{appCanaryName(myAppResource), appPreviewName(myAppResource)} {
+		done, err := r.scaleDownReplicaSet(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: name})
+		if err != nil {
+			return false, err
+		}
+		replicaSetsDone = replicaSetsDone && done
+	}
+	deploymentDone, err := r.scaleDownDeployment(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name})
+	return replicaSetsDone && deploymentDone, err
+}
+
+// teardownRedis scales the Redis StatefulSet to zero and deletes it once its
+// pods are gone, together with its Services, its auth Secret, the Sentinels
+// and any Redis Deployment left over from earlier controller versions. It
+// reports whether Redis is fully removed. The PersistentVolumeClaims are kept.
+func (r *MyAppResourceReconciler) teardownRedis(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (bool, error) {
+	key := client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisName(myAppResource)}
+	statefulSetDone, err := r.scaleDownStatefulSet(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	deploymentDone, err := r.scaleDownDeployment(ctx, key)
+	if err != nil || !statefulSetDone || !deploymentDone {
+		return false, err
+	}
+
+	for _, obj := range redisObjects(myAppResource) {
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// scaleDownStatefulSet sets the replicas of a StatefulSet to zero and reports
+// whether the StatefulSet has no pods left. A missing StatefulSet counts as
+// scaled down.
+func (r *MyAppResourceReconciler) scaleDownStatefulSet(ctx context.Context, key client.ObjectKey) (bool, error) {
+	log := ctrl.Log.WithValues("statefulset", key)
+
+	statefulSet := &appsv1.StatefulSet{}
+	if err := r.Get(ctx, key, statefulSet); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if statefulSet.Spec.Replicas == nil || *statefulSet.Spec.Replicas != 0 {
+		log.Info("Scaling statefulset to zero", "Namespace", key.Namespace, "Name", key.Name)
+		patch := client.MergeFrom(statefulSet.DeepCopy())
+		replicas := int32(0)
+		statefulSet.Spec.Replicas = &replicas
+		if err := r.Patch(ctx, statefulSet, patch); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	return statefulSet.Status.ObservedGeneration >= statefulSet.Generation && statefulSet.Status.Replicas == 0, nil
+}
+
+// scaleDownDeployment sets the replicas of a Deployment to zero and reports
+// whether the Deployment has no pods left. A missing Deployment counts as
+// scaled down.
+func (r *MyAppResourceReconciler) scaleDownDeployment(ctx context.Context, key client.ObjectKey) (bool, error) {
+	log := ctrl.Log.WithValues("deployment", key)
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, key, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0 {
+		log.Info("Scaling deployment to zero", "Namespace", key.Namespace, "Name", key.Name)
+		patch := client.MergeFrom(deployment.DeepCopy())
+		replicas := int32(0)
+		deployment.Spec.Replicas = &replicas
+		if err := r.Patch(ctx, deployment, patch); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation && deployment.Status.Replicas == 0, nil
+}
+
+// scaleDownReplicaSet sets the replicas of a ReplicaSet to zero and reports
+// whether the ReplicaSet has no pods left. A missing ReplicaSet counts as
+// scaled down.
+func (r *MyAppResourceReconciler) scaleDownReplicaSet(ctx context.Context, key client.ObjectKey) (bool, error) {
+	log := ctrl.Log.WithValues("replicaset", key)
+
+	replicaSet := &appsv1.ReplicaSet{}
+	if err := r.Get(ctx, key, replicaSet); err != nil {
+		if errors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	if replicaSet.Spec.Replicas == nil || *replicaSet.Spec.Replicas != 0 {
+		log.Info("Scaling replicaset to zero", "Namespace", key.Namespace, "Name", key.Name)
+		patch := client.MergeFrom(replicaSet.DeepCopy())
+		replicas := int32(0)
+		replicaSet.Spec.Replicas = &replicas
+		if err := r.Patch(ctx, replicaSet, patch); err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+
+	return replicaSet.Status.ObservedGeneration >= replicaSet.Generation && replicaSet.Status.Replicas == 0, nil
+}
+
+// reconcilePreDeleteHook creates the pre-delete hook Job if it does not exist
+// and returns it.
+func (r *MyAppResourceReconciler) reconcilePreDeleteHook(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (*batchv1.Job, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: preDeleteHookName(myAppResource)}, job)
+	if err == nil {
+		return job, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	hook := myAppResource.Spec.PreDeleteHook
+	job = &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      preDeleteHookName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	log.Info("Creating pre-delete hook job", "Namespace", job.Namespace, "Name", job.Name)
+	op, err := r.apply(ctx, myAppResource, job, func() error {
+		job.Labels = componentLabels(myAppResource, componentPreDeleteHook)
+		job.Spec = batchv1.JobSpec{
+			BackoffLimit:          hook.BackoffLimit,
+			ActiveDeadlineSeconds: hook.ActiveDeadlineSeconds,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: componentLabels(myAppResource, componentPreDeleteHook),
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy:    corev1.RestartPolicyNever,
+					ImagePullSecrets: myAppResource.Spec.ImagePullSecrets,
+					Containers: []corev1.Container{
+						{
+							Name:            preDeleteHookContainerName,
+							Image:           containerImageName(hook.Image),
+							ImagePullPolicy: hook.Image.PullPolicy,
+							Command:         hook.Command,
+							Args:            hook.Args,
+						},
+					},
+				},
+			},
+		}
+
+		// The Job is owned by the MyAppResource so it is garbage collected with it
+		return ctrl.SetControllerReference(myAppResource, job, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.recordCreated(myAppResource, job, op)
+	return job, nil
+}
+
+// jobComplete reports whether a Job finished successfully.
+func jobComplete(job *batchv1.Job) bool {
+	return jobConditionTrue(job, batchv1.JobComplete)
+}
+
+// jobFailed reports whether a Job failed permanently.
+func jobFailed(job *batchv1.Job) bool {
+	return jobConditionTrue(job, batchv1.JobFailed)
+}
+
+func jobConditionTrue(job *batchv1.Job, conditionType batchv1.JobConditionType) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// reportTeardown records the current teardown step in the Terminating
+// condition. Steps other than the final one are checked back on periodically,
+// since the pods and Jobs they wait for are not watched.
+func (r *MyAppResourceReconciler) reportTeardown(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, reason, message string) (ctrl.Result, error) {
+	original := myAppResource.Status.DeepCopy()
+	meta.SetStatusCondition(&myAppResource.Status.Conditions, metav1.Condition{
+		Type:               myapigroupv1beta1.ConditionTerminating,
+		Status:             metav1.ConditionTrue,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: myAppResource.Generation,
+	})
+	if !equality.Semantic.DeepEqual(original, &myAppResource.Status) {
+		if err := r.Status().Update(ctx, myAppResource); err != nil {
+			if !errors.IsNotFound(err) {
+				return ctrl.Result{}, err
+			}
+		} else {
+			r.recordConditionEvents(myAppResource, original.Conditions)
+		}
+	}
+
+	if reason == reasonTeardownComplete {
+		return ctrl.Result{}, nil
+	}
+	if reason == reasonPreDeleteHookFailed {
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// The recommended labels set on every object the controller creates. Pods are
+// selected by name, instance and component, so the app, Redis and Sentinel
+// pods of a MyAppResource never select each other.
+const (
+	labelName      = "app.kubernetes.io/name"
+	labelInstance  = "app.kubernetes.io/instance"
+	labelComponent = "app.kubernetes.io/component"
+	labelManagedBy = "app.kubernetes.io/managed-by"
+
+	// labelNameValue names the application the objects make up.
+	labelNameValue = "myappresource"
+	// labelManagedByValue names the controller managing the objects.
+	labelManagedByValue = "angiplatform"
+)
+
+// Values of the component label.
+const (
+	componentApp           = "app"
+	componentRedis         = "redis"
+	componentRedisSentinel = "redis-sentinel"
+	componentPreDeleteHook = "pre-delete-hook"
+)
+
+// Labels set by earlier versions of the controller. They are no longer
+// applied, except where an immutable selector still needs them until the
+// object is recreated.
+const (
+	legacyLabelApp       = "app"
+	legacyLabelComponent = "component"
+)
+
+// selectorLabels returns the labels the pods of a component are selected by.
+func selectorLabels(myAppResource *myapigroupv1beta1.MyAppResource, component string) map[string]string {
+	return map[string]string{
+		labelName:      labelNameValue,
+		labelInstance:  myAppResource.Name,
+		labelComponent: component,
+	}
+}
+
+// componentLabels returns the labels set on the objects and pods of a component.
+func componentLabels(myAppResource *myapigroupv1beta1.MyAppResource, component string) map[string]string {
+	labels := selectorLabels(myAppResource, component)
+	labels[labelManagedBy] = labelManagedByValue
+	return labels
+}
+
+// instanceRequest maps an object labelled by the controller to the
+// MyAppResource named by its instance label. Pods are owned by ReplicaSets
+// and StatefulSets rather than the MyAppResource, so they are mapped back
+// this way.
+func instanceRequest(_ context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels[labelName] != labelNameValue || labels[labelInstance] == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: obj.GetNamespace(), Name: labels[labelInstance]}}}
+}
+
+// apiReader returns the reader for objects that may not carry the managed-by
+// label yet, and so may be missing from the cache.
+func (r *MyAppResourceReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// getObject reads an owned object from the cache and, when it is not found
+// there, from the API server, as the object may have been written by an
+// earlier controller version without the managed-by label.
+func (r *MyAppResourceReconciler) getObject(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	err := r.Get(ctx, key, obj)
+	if !errors.IsNotFound(err) || r.APIReader == nil {
+		return err
+	}
+	return r.APIReader.Get(ctx, key, obj)
+}
+
+// hasLabels reports whether labels contains all entries of want.
+func hasLabels(labels, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := labels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// workloadPods returns the selector and the pod template of a Deployment or
+// StatefulSet.
+func workloadPods(workload client.Object) (*metav1.LabelSelector, *corev1.PodTemplateSpec) {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return w.Spec.Selector, &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return w.Spec.Selector, &w.Spec.Template
+	}
+	return nil, nil
+}
+
+// staleSelector reports whether an existing selector does not select by
+// exactly the desired labels, as with the selectors of earlier controller
+// versions.
+func staleSelector(selector *metav1.LabelSelector, desired map[string]string) bool {
+	return selector != nil && (len(selector.MatchExpressions) > 0 || !equality.Semantic.DeepEqual(selector.MatchLabels, desired))
+}
+
+// podSelector returns the labels to select the pods of a workload by. While a
+// workload still selects its pods by a stale selector, its pods are only
+// relabelled as they roll, so Services keep selecting them by that selector.
+func (r *MyAppResourceReconciler) podSelector(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, workload client.Object, desired map[string]string) (map[string]string, error) {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(workload), workload); err != nil {
+		if errors.IsNotFound(err) {
+			return desired, nil
+		}
+		return nil, err
+	}
+	selector, _ := workloadPods(workload)
+	if !metav1.IsControlledBy(workload, myAppResource) || !workload.GetDeletionTimestamp().IsZero() ||
+		!staleSelector(selector, desired) || len(selector.MatchLabels) == 0 || len(selector.MatchExpressions) > 0 {
+		return desired, nil
+	}
+	matchLabels := make(map[string]string, len(selector.MatchLabels))
+	for k, v := range selector.MatchLabels {
+		matchLabels[k] = v
+	}
+	return matchLabels, nil
+}
+
+// selectorMigration tells where a workload stands in moving to the desired
+// selector.
+type selectorMigration int
+
+const (
+	// selectorCurrent means the workload selects its pods by the desired labels.
+	selectorCurrent selectorMigration = iota
+	// selectorRelabelling means the workload keeps its stale selector while
+	// its pods are rolled with the desired labels.
+	selectorRelabelling
+	// selectorReplacing means the workload is being deleted so that it can
+	// be created again with the desired selector.
+	selectorReplacing
+)
+
+// migrateSelector moves an existing Deployment or StatefulSet off a stale
+// selector, which cannot be changed in place. Its pods are first rolled with
+// the desired labels while the selector stays as it is. Once ready is true the
+// workload is deleted with its pods orphaned, so that the workload created in
+// its place adopts them without an outage.
+func (r *MyAppResourceReconciler) migrateSelector(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, workload client.Object, desired map[string]string, ready bool) (selectorMigration, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	if !workload.GetDeletionTimestamp().IsZero() && metav1.IsControlledBy(workload, myAppResource) {
+		log.Info("Waiting for the workload to be deleted before creating it again", "Namespace", workload.GetNamespace(), "Name", workload.GetName())
+		return selectorReplacing, nil
+	}
+	selector, template := workloadPods(workload)
+	if !metav1.IsControlledBy(workload, myAppResource) || !staleSelector(selector, desired) {
+		return selectorCurrent, nil
+	}
+	if !hasLabels(template.Labels, desired) || !ready {
+		return selectorRelabelling, nil
+	}
+
+	log.Info("Recreating workload to change its selector; its pods are kept for the new one", "Namespace", workload.GetNamespace(), "Name", workload.GetName())
+	if err := r.Delete(ctx, workload, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil && !errors.IsNotFound(err) {
+		return selectorRelabelling, err
+	}
+	r.recordEvent(myAppResource, corev1.EventTypeNormal, eventRecreating,
+		fmt.Sprintf("Recreating %s %s to change its selector; its pods are kept", r.objectKind(workload), workload.GetName()))
+	return selectorReplacing, nil
+}
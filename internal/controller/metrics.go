@@ -0,0 +1,150 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// Metrics about each MyAppResource, served with the controller-runtime
+// metrics on the metrics endpoint of the manager. Every series is labelled
+// with the namespace and name of the MyAppResource and removed once it is
+// deleted.
+var (
+	desiredReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_desired_replicas",
+		Help: "Number of app replicas desired for the MyAppResource.",
+	}, []string{"namespace", "name"})
+
+	readyReplicas = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_ready_replicas",
+		Help: "Number of ready app replicas of the MyAppResource.",
+	}, []string{"namespace", "name"})
+
+	redisUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_redis_up",
+		Help: "Whether all Redis replicas of the MyAppResource are ready (1) or not (0). Absent while Redis is disabled.",
+	}, []string{"namespace", "name"})
+
+	rolloutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "myappresource_rollout_duration_seconds",
+		Help:    "Time from the start of an app rollout until all replicas are updated and available.",
+		Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+	}, []string{"namespace", "name"})
+
+	specInvalid = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "myappresource_spec_invalid",
+		Help: "Whether the spec of the MyAppResource fails validation (1) or not (0).",
+	}, []string{"namespace", "name"})
+
+	specValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "myappresource_spec_validation_failures_total",
+		Help: "Number of reconciles that found the spec of the MyAppResource invalid.",
+	}, []string{"namespace", "name"})
+
+	podsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "myappresource_pods_created_total",
+		Help: "Number of pods the controller added by scaling up the app Deployment or Redis StatefulSets of the MyAppResource.",
+	}, []string{"namespace", "name", "component"})
+
+	podsDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "myappresource_pods_deleted_total",
+		Help: "Number of pods the controller removed by scaling down the app Deployment or Redis StatefulSets of the MyAppResource or by deleting them.",
+	}, []string{"namespace", "name", "component"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		desiredReplicas,
+		readyReplicas,
+		redisUp,
+		rolloutDuration,
+		specInvalid,
+		specValidationFailures,
+		podsCreated,
+		podsDeleted,
+	)
+}
+
+// recordStatusMetrics sets the gauges from the status computed for the
+// MyAppResource. They are set on every reconcile, so they are filled in again
+// after the manager restarts.
+func recordStatusMetrics(myAppResource *myapigroupv1beta1.MyAppResource) {
+	status := myAppResource.Status
+	desiredReplicas.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Set(float64(status.App.Replicas))
+	readyReplicas.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Set(float64(status.App.ReadyReplicas))
+	invalid := 0.0
+	if meta.IsStatusConditionTrue(status.Conditions, myapigroupv1beta1.ConditionSpecInvalid) {
+		invalid = 1
+	}
+	specInvalid.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Set(invalid)
+
+	if !myAppResource.Spec.Redis.Enabled {
+		redisUp.DeleteLabelValues(myAppResource.Namespace, myAppResource.Name)
+		return
+	}
+	up := 0.0
+	if meta.IsStatusConditionTrue(status.Conditions, myapigroupv1beta1.ConditionRedisReady) {
+		up = 1
+	}
+	redisUp.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Set(up)
+}
+
+// observeRolloutDuration records how long a rollout took once the Progressing
+// condition moves from rolling out to complete since original.
+func observeRolloutDuration(myAppResource *myapigroupv1beta1.MyAppResource, original []metav1.Condition) {
+	previous := meta.FindStatusCondition(original, myapigroupv1beta1.ConditionProgressing)
+	current := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionProgressing)
+	if previous == nil || current == nil || previous.Reason != reasonRollingOut || current.Reason != reasonRolloutComplete {
+		return
+	}
+	duration := current.LastTransitionTime.Sub(previous.LastTransitionTime.Time)
+	rolloutDuration.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Observe(duration.Seconds())
+}
+
+// recordScaledPods counts the pods added or removed by scaling a workload of
+// a component from one number of replicas to another.
+func recordScaledPods(myAppResource *myapigroupv1beta1.MyAppResource, component string, from, to int32) {
+	switch {
+	case to > from:
+		podsCreated.WithLabelValues(myAppResource.Namespace, myAppResource.Name, component).Add(float64(to - from))
+	case to < from:
+		podsDeleted.WithLabelValues(myAppResource.Namespace, myAppResource.Name, component).Add(float64(from - to))
+	}
+}
+
+// deleteMetrics removes the series of a MyAppResource that is gone.
+func deleteMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "name": name}
+	for _, vec := range []*prometheus.MetricVec{
+		desiredReplicas.MetricVec,
+		readyReplicas.MetricVec,
+		redisUp.MetricVec,
+		rolloutDuration.MetricVec,
+		specInvalid.MetricVec,
+		specValidationFailures.MetricVec,
+		podsCreated.MetricVec,
+		podsDeleted.MetricVec,
+	} {
+		vec.DeletePartialMatch(labels)
+	}
+}
@@ -18,31 +18,70 @@ package controller
 
 import (
 	"context"
-	"fmt"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	myapigroupv1alpha1 "github.com/kommineni24/k8appcontroller/api/v1alpha1"
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
 )
 
 // MyAppResourceReconciler reconciles a MyAppResource object
 type MyAppResourceReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	// Sentinel looks up the current Redis primary in sentinel mode. It
+	// defaults to connecting to the Sentinel Service directly.
+	Sentinel SentinelClient
+	// Recorder records events on the MyAppResource. Events are dropped when
+	// it is nil.
+	Recorder record.EventRecorder
+	// APIReader reads from the API server, bypassing the cache, which only
+	// holds the Secrets and Pods labelled as managed by the controller (see
+	// CacheByObject). Objects written by earlier controller versions are
+	// looked up with it. The Client is used when it is nil.
+	APIReader client.Reader
+}
+
+// CacheByObject limits the cache of the manager to the Secrets and Pods
+// labelled as managed by the controller, so that it does not hold every
+// Secret and Pod in the cluster.
+func CacheByObject() map[client.Object]cache.ByObject {
+	managed := labels.SelectorFromSet(labels.Set{labelManagedBy: labelManagedByValue})
+	return map[client.Object]cache.ByObject{
+		&corev1.Secret{}: {Label: managed},
+		&corev1.Pod{}:    {Label: managed},
+	}
 }
 
 //+kubebuilder:rbac:groups=my.api.group.rama.angi.platform,resources=myappresources,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=my.api.group.rama.angi.platform,resources=myappresources/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=my.api.group.rama.angi.platform,resources=myappresources/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch;delete
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=autoscaling,resources=horizontalpodautoscalers,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -50,217 +89,180 @@ func (r *MyAppResourceReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	log := ctrl.Log.WithValues("myappresource", req.NamespacedName)
 
 	// Fetch the MyAppResource instance
-	myAppResource := &myapigroupv1alpha1.MyAppResource{}
+	myAppResource := &myapigroupv1beta1.MyAppResource{}
 	if err := r.Get(ctx, req.NamespacedName, myAppResource); err != nil {
+		if errors.IsNotFound(err) {
+			// The resource is gone, so there is nothing left to reconcile
+			deleteMetrics(req.Namespace, req.Name)
+			return ctrl.Result{}, nil
+		}
 		log.Error(err, "Failed to fetch MyAppResource")
 		return ctrl.Result{}, err
 	}
 
-	// Reconciliation logic
-	replicaCount := myAppResource.Spec.ReplicaCount
-	image := myAppResource.Spec.Image
-	resources := myAppResource.Spec.Resources
-	ui := myAppResource.Spec.UI
-	redisEnabled := myAppResource.Spec.Redis.Enabled
-	redisReplicaCount := int32(1) // Default to 1 replica
+	// Objects stored before the defaulting webhook was installed may have unset
+	// fields, so the same defaults are applied in memory
+	myAppResource.Spec.Default()
 
-	// Check if replica count for Redis is specified
-	if myAppResource.Spec.Redis.ReplicaCount != nil {
-		redisReplicaCount = *myAppResource.Spec.Redis.ReplicaCount
+	if !myAppResource.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, myAppResource)
 	}
 
-	// Deploy main application pods
-	if replicaCount > 0 {
-		// Create or delete pods based on replica count
-		podList := &corev1.PodList{}
-		if err := r.List(ctx, podList, client.InNamespace(req.Namespace), client.MatchingLabels{"app": req.Name}); err != nil {
-			log.Error(err, "Failed to list pods")
+	original := myAppResource.Status.DeepCopy()
+
+	// A spec that fails validation is reported without touching the owned
+	// objects. Retrying cannot fix it, so the resource is not requeued; the
+	// next change to the spec triggers a reconcile.
+	desired := r.checkSpec(myAppResource)
+	if desired == nil {
+		if err := r.updateStatus(ctx, myAppResource, original, errSpecNotApplied); err != nil {
+			log.Error(err, "Failed to update MyAppResource status")
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, nil
+	}
 
-		for _, pod := range podList.Items {
-			// Update pod's image and resources if they differ from the spec
-			var updated bool
-			for i, container := range pod.Spec.Containers {
-				if container.Name == "app-container" {
-					if container.Image != fmt.Sprintf("%s:%s", image.Repository, image.Tag) {
-						pod.Spec.Containers[i].Image = fmt.Sprintf("%s:%s", image.Repository, image.Tag)
-						updated = true
-					}
-					if cpuReq, ok := container.Resources.Requests[corev1.ResourceCPU]; ok && cpuReq.String() != resources.CPURequest {
-						pod.Spec.Containers[i].Resources.Requests[corev1.ResourceCPU] = resource.MustParse(resources.CPURequest)
-						updated = true
-					}
-					if memLimit, ok := container.Resources.Limits[corev1.ResourceMemory]; ok && memLimit.String() != resources.MemoryLimit {
-						pod.Spec.Containers[i].Resources.Limits[corev1.ResourceMemory] = resource.MustParse(resources.MemoryLimit)
-						updated = true
-					}
-					break // No need to continue iterating once we've found the app container
-				}
-			}
-			// If any updates were made, update the pod
-			if updated {
-				if err := r.Update(ctx, &pod); err != nil {
-					log.Error(err, "Failed to update pod", "Namespace", pod.Namespace, "Name", pod.Name)
-					return ctrl.Result{}, err
-				}
-				log.Info("Updated pod", "Namespace", pod.Namespace, "Name", pod.Name)
-				// Add logic to handle the updated pod if needed
-			}
-		}
+	// Hold the resource on deletion until its workloads are torn down
+	if err := r.ensureFinalizer(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to add finalizer")
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.reconcileResources(ctx, myAppResource, desired)
 
-		currentReplicaCount := int32(len(podList.Items))
-
-		if currentReplicaCount < replicaCount {
-			for i := currentReplicaCount; i < replicaCount; i++ {
-				pod := &corev1.Pod{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      fmt.Sprintf("%s-%d", req.Name, i),
-						Namespace: req.Namespace,
-						Labels: map[string]string{
-							"app":   req.Name,
-							"color": ui.Color,
-						},
-						Annotations: map[string]string{
-							"message": ui.Message,
-						},
-					},
-					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{
-							{
-								Name:  "app-container",
-								Image: fmt.Sprintf("%s:%s", image.Repository, image.Tag),
-								Resources: corev1.ResourceRequirements{
-									Requests: corev1.ResourceList{
-										corev1.ResourceCPU:    resource.MustParse(resources.CPURequest),
-										corev1.ResourceMemory: resource.MustParse(resources.MemoryLimit),
-									},
-								},
-							},
-						},
-					},
-				}
-				if err := ctrl.SetControllerReference(myAppResource, pod, r.Scheme); err != nil {
-					log.Error(err, "Failed to set controller reference")
-					return ctrl.Result{}, err
-				}
-				if err := r.Create(ctx, pod); err != nil {
-					log.Error(err, "Failed to create pod", "Namespace", pod.Namespace, "Name", pod.Name)
-					return ctrl.Result{}, err
-				}
-			}
-		} else if currentReplicaCount > replicaCount {
-			for i := currentReplicaCount - 1; i >= replicaCount; i-- {
-				// Get the ObjectKey of the pod for deletion
-				pod := podList.Items[i]
-				podKey := client.ObjectKey{Namespace: pod.Namespace, Name: pod.Name}
-				if err := r.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace, Name: pod.Name}}); err != nil {
-					log.Error(err, "Failed to delete pod", "Namespace", pod.Namespace, "Name", pod.Name)
-					return ctrl.Result{}, err
-				}
-				// Ensure that the pod is deleted by waiting until it's no longer found
-				if err := r.waitForDeletion(ctx, podKey); err != nil {
-					log.Error(err, "Failed to wait for pod deletion", "Namespace", pod.Namespace, "Name", pod.Name)
-					// You can choose to return an error here if desired
-				}
-			}
+	// Report the observed state, including any error from this pass
+	if statusErr := r.updateStatus(ctx, myAppResource, original, err); statusErr != nil {
+		log.Error(statusErr, "Failed to update MyAppResource status")
+		if err == nil {
+			return ctrl.Result{}, statusErr
 		}
 	}
+	if conflict, ok := asFieldConflict(err); ok {
+		// Retrying right away does not resolve a conflict; a change to the
+		// object by the other manager triggers a reconcile anyway
+		log.Info("Not taking over fields or objects managed by someone else", "conflict", conflict.Error())
+		return ctrl.Result{RequeueAfter: time.Minute}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
 
-	// Deploy Redis instance if enabled
-	if redisEnabled {
-		// Define Redis deployment
-		redisDeployment := &appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      fmt.Sprintf("%s-redis", myAppResource.Name),
-				Namespace: myAppResource.Namespace,
-			},
-			Spec: appsv1.DeploymentSpec{
-				Replicas: &redisReplicaCount,
-				Selector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						"app": myAppResource.Name,
-					},
-				},
-				Template: corev1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: map[string]string{
-							"app": myAppResource.Name,
-						},
-					},
-					Spec: corev1.PodSpec{
-						Containers: []corev1.Container{
-							{
-								Name:  "redis",
-								Image: "redis:latest",
-							},
-						},
-					},
-				},
-			},
-		}
+// reconcileResources applies every object owned by the MyAppResource, rendered
+// from the desired state of its spec.
+func (r *MyAppResourceReconciler) reconcileResources(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (ctrl.Result, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
 
-		// Set MyAppResource instance as the owner and controller
-		if err := ctrl.SetControllerReference(myAppResource, redisDeployment, r.Scheme); err != nil {
-			log.Error(err, "Failed to set controller reference for Redis deployment")
+	// Reconciliation logic
+	redisEnabled := myAppResource.Spec.Redis.Enabled
+
+	// Deploy Redis instance if enabled. Redis goes first so that the app is
+	// only restarted for a new password once Redis accepts it.
+	redisMigrationPending := false
+	if redisEnabled {
+		var err error
+		redisMigrationPending, err = r.reconcileRedis(ctx, myAppResource, desired)
+		if err != nil {
 			return ctrl.Result{}, err
 		}
+	}
+
+	// The autoscaler is settled first: turning autoscaling off removes it before
+	// the Deployment goes back to the replica count of the spec
+	if err := r.reconcileAppAutoscaler(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile app autoscaler")
+		return ctrl.Result{}, err
+	}
 
-		// Check if the Redis deployment exists
-		found := &appsv1.Deployment{}
-		err := r.Get(ctx, client.ObjectKey{Namespace: redisDeployment.Namespace, Name: redisDeployment.Name}, found)
-		if err != nil && errors.IsNotFound(err) {
-			log.Info("Creating Redis deployment", "Namespace", redisDeployment.Namespace, "Name", redisDeployment.Name)
-			err = r.Create(ctx, redisDeployment)
-			if err != nil {
-				log.Error(err, "Failed to create Redis deployment", "Namespace", redisDeployment.Namespace, "Name", redisDeployment.Name)
-				return ctrl.Result{}, err
-			}
-		} else if err != nil {
-			log.Error(err, "Failed to get Redis deployment")
+	// Advance a rollout of a new app revision first, since it decides whether
+	// the Deployment moves to that revision
+	rolloutRequeue, err := r.reconcileAppRollout(ctx, myAppResource, desired)
+	if err != nil {
+		log.Error(err, "Failed to reconcile app rollout")
+		return ctrl.Result{}, err
+	}
+
+	// Deploy the main application through its Deployment
+	appDeployment, scaleDownPending, err := r.reconcileAppDeployment(ctx, myAppResource, desired)
+	if err != nil {
+		log.Error(err, "Failed to reconcile app deployment")
+		return ctrl.Result{}, err
+	}
+
+	if err := r.reconcileAppDisruptionBudget(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile app disruption budget")
+		return ctrl.Result{}, err
+	}
+
+	// Expose the app through its Service and, when configured, an Ingress
+	if err := r.reconcileAppService(ctx, myAppResource, desired); err != nil {
+		log.Error(err, "Failed to reconcile app service")
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileAppPreviewService(ctx, myAppResource, desired); err != nil {
+		log.Error(err, "Failed to reconcile app preview service")
+		return ctrl.Result{}, err
+	}
+	if err := r.reconcileAppIngress(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile app ingress")
+		return ctrl.Result{}, err
+	}
+
+	// Remove pods created directly by earlier controller versions once the
+	// Deployment has taken over
+	legacyPodsPending, err := r.drainLegacyPods(ctx, myAppResource, appDeployment)
+	if err != nil {
+		log.Error(err, "Failed to drain legacy pods")
+		return ctrl.Result{}, err
+	}
+
+	// Remove Redis once it is disabled. This runs after the app Deployment has
+	// been updated so that the app no longer points at Redis.
+	if !redisEnabled {
+		removed, err := r.removeRedis(ctx, myAppResource)
+		myAppResource.Status.Redis.Removed = append(myAppResource.Status.Redis.Removed, removed...)
+		if err != nil {
+			log.Error(err, "Failed to remove Redis")
 			return ctrl.Result{}, err
 		}
+	}
 
-		// Ensure the deployment size is the same as the spec
-		// size := redisReplicaCount
-		// if *found.Spec.Replicas != size {
-		// 	found.Spec.Replicas = &size
-		// 	err = r.Update(ctx, found)
-		// 	if err != nil {
-		// 		log.Error(err, "Failed to update Redis deployment", "Namespace", found.Namespace, "Name", found.Name)
-		// 		return ctrl.Result{}, err
-		// 	}
-		// }
-
+	if legacyPodsPending || redisMigrationPending || scaleDownPending {
+		// Check back until the new workloads are available and the old ones are gone
+		return ctrl.Result{RequeueAfter: 5 * time.Second}, nil
 	}
 
-	return ctrl.Result{}, nil
+	requeueAfter := rolloutRequeue
+	if redisEnabled && redisSentinelMode(myAppResource) && (requeueAfter == 0 || sentinelPollInterval < requeueAfter) {
+		// Follow the primary as Sentinel fails over
+		requeueAfter = sentinelPollInterval
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-// SetupWithManager sets up the controller with the Manager.
+// SetupWithManager sets up the controller with the Manager. Besides changes to
+// the MyAppResource, changes to any object it owns trigger a reconcile, so
+// that drift is corrected and the status follows the workloads as they roll
+// out. Managed pods are mapped back by their instance label, so that a
+// scale-down goes on as soon as the pods of a batch are gone. Updates that only touch the MyAppResource status, which this
+// controller writes itself, are filtered out; annotation changes pass since
+// they request a promotion or a password rotation.
 func (r *MyAppResourceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	owned := builder.WithPredicates(ownedObjectPredicate())
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&myapigroupv1alpha1.MyAppResource{}).
+		For(&myapigroupv1beta1.MyAppResource{}, builder.WithPredicates(
+			predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}),
+		)).
+		Owns(&appsv1.Deployment{}, owned).
+		Owns(&appsv1.ReplicaSet{}, owned).
+		Owns(&appsv1.StatefulSet{}, owned).
+		Owns(&corev1.Service{}, owned).
+		Owns(&corev1.Secret{}, owned).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(instanceRequest), owned).
+		Owns(&batchv1.Job{}, owned).
+		Owns(&networkingv1.Ingress{}, owned).
+		Owns(&autoscalingv2.HorizontalPodAutoscaler{}, owned).
+		Owns(&policyv1.PodDisruptionBudget{}, owned).
 		Complete(r)
 }
-
-// Function to wait for pod deletion
-func (r *MyAppResourceReconciler) waitForDeletion(ctx context.Context, podKey client.ObjectKey) error {
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		case <-time.After(time.Second * 5):
-			// Check if the pod still exists
-			pod := &corev1.Pod{}
-			err := r.Get(ctx, podKey, pod)
-			if err != nil && errors.IsNotFound(err) {
-				// Pod is deleted
-				return nil
-			} else if err != nil {
-				// Error occurred while fetching the pod
-				return err
-			}
-		}
-	}
-}
@@ -19,19 +19,34 @@ package controller
 import (
 	"context"
 	"fmt"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	myapigroupv1alpha1 "github.com/kommineni24/k8appcontroller/api/v1alpha1"
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
 )
 
 var _ = Describe("MyAppResource Controller", func() {
@@ -44,19 +59,31 @@ var _ = Describe("MyAppResource Controller", func() {
 			Name:      resourceName,
 			Namespace: "default", // TODO(user):Modify as needed
 		}
-		myAppResource := &myapigroupv1alpha1.MyAppResource{}
+		myAppResource := &myapigroupv1beta1.MyAppResource{}
 		var reconciler *MyAppResourceReconciler
+		var recorder *record.FakeRecorder
 
 		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(100)
+			reconciler = &MyAppResourceReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Recorder: recorder,
+			}
+
 			By("creating the custom resource for the Kind MyAppResource")
 			err := k8sClient.Get(ctx, typeNamespacedName, myAppResource)
 			if err != nil && errors.IsNotFound(err) {
-				resource := &myapigroupv1alpha1.MyAppResource{
+				resource := &myapigroupv1beta1.MyAppResource{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
 					},
 					// TODO(user): Specify other spec details if needed.
+					// The controller rejects a spec without an image repository
+					Spec: myapigroupv1beta1.MyAppResourceSpec{
+						Image: myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo"},
+					},
 				}
 				Expect(k8sClient.Create(ctx, resource)).To(Succeed())
 			}
@@ -64,12 +91,69 @@ var _ = Describe("MyAppResource Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &myapigroupv1alpha1.MyAppResource{}
+			resource := &myapigroupv1beta1.MyAppResource{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
-			Expect(err).NotTo(HaveOccurred())
+			if err != nil {
+				// The test may have deleted the resource itself
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			} else {
+				By("Cleanup the specific resource instance MyAppResource")
+				Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
 
-			By("Cleanup the specific resource instance MyAppResource")
-			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+				By("Running the teardown until the finalizer is released")
+				Eventually(func() error {
+					// Envtest has no workload controllers, so mark every scale-down as observed
+					for _, name := range []string{resourceName, fmt.Sprintf("%s-redis", resourceName), fmt.Sprintf("%s-canary", resourceName), fmt.Sprintf("%s-preview", resourceName)} {
+						key := types.NamespacedName{Name: name, Namespace: "default"}
+						replicaSet := &appsv1.ReplicaSet{}
+						if err := k8sClient.Get(ctx, key, replicaSet); err == nil {
+							replicaSet.Status.ObservedGeneration = replicaSet.Generation
+							replicaSet.Status.Replicas = 0
+							replicaSet.Status.ReadyReplicas = 0
+							replicaSet.Status.AvailableReplicas = 0
+							if err := k8sClient.Status().Update(ctx, replicaSet); err != nil {
+								return err
+							}
+						}
+						deployment := &appsv1.Deployment{}
+						if err := k8sClient.Get(ctx, key, deployment); err == nil {
+							deployment.Status.ObservedGeneration = deployment.Generation
+							if err := k8sClient.Status().Update(ctx, deployment); err != nil {
+								return err
+							}
+						}
+						statefulSet := &appsv1.StatefulSet{}
+						if err := k8sClient.Get(ctx, key, statefulSet); err == nil {
+							statefulSet.Status.ObservedGeneration = statefulSet.Generation
+							if err := k8sClient.Status().Update(ctx, statefulSet); err != nil {
+								return err
+							}
+						}
+					}
+					if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName}); err != nil {
+						return err
+					}
+					return k8sClient.Get(ctx, typeNamespacedName, &myapigroupv1beta1.MyAppResource{})
+				}).Should(Satisfy(errors.IsNotFound))
+			}
+
+			// Envtest runs no garbage collector, so remove the owned objects left behind
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, deployment))).To(Succeed())
+			service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, service))).To(Succeed())
+			ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, ingress))).To(Succeed())
+			pdb := &policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, pdb))).To(Succeed())
+			canary := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-canary", resourceName), Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, canary))).To(Succeed())
+			preview := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-preview", resourceName), Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, preview))).To(Succeed())
+			previewService := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-preview", resourceName), Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, previewService))).To(Succeed())
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-pre-delete", resourceName), Namespace: "default"}}
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)))).To(Succeed())
 		})
 		It("should successfully reconcile the resource", func() {
 			By("Reconciling the created resource")
@@ -89,43 +173,56 @@ var _ = Describe("MyAppResource Controller", func() {
 		It("should handle error when custom resource doesn't exist", func() {
 			// Set up the environment by deleting the custom resource
 			// that was created in BeforeEach
-			resource := &myapigroupv1alpha1.MyAppResource{}
+			resource := &myapigroupv1beta1.MyAppResource{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
 
-			// Reconcile the resource and expect an error
+			// Reconcile the resource and expect it to be ignored
 			controllerReconciler := &MyAppResourceReconciler{
 				Client: k8sClient,
 				Scheme: k8sClient.Scheme(),
 			}
 
-			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{
 				NamespacedName: typeNamespacedName,
 			})
-			Expect(err).To(HaveOccurred())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
 		})
 
-		// Test case for creating pods
-		It("should create pods based on replica count", func() {
+		// Test case for creating the app Deployment
+		It("should create a Deployment based on replica count", func() {
 			// Setup
 			ctx := context.Background()
 			resourceName := "test-resource"
 			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
-			var replicaCount = 4
+
+			// Set the replica count on the custom resource
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 4
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
 			// Reconcile the resource
 			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
 
-			// Verify that pods are created
-			podList := &corev1.PodList{}
-			err = k8sClient.List(ctx, podList, client.InNamespace(typeNamespacedName.Namespace), client.MatchingLabels{"app": resourceName})
+			// Verify that the Deployment is created and owned by the custom resource
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, typeNamespacedName, deployment)
 			Expect(err).NotTo(HaveOccurred())
-			Expect(len(podList.Items)).To(Equal(int(replicaCount))) // Assuming replicaCount is a predefined value
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+			Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{
+				"app.kubernetes.io/name":      "myappresource",
+				"app.kubernetes.io/instance":  resourceName,
+				"app.kubernetes.io/component": "app",
+			}))
+			Expect(deployment.Labels).To(HaveKeyWithValue("app.kubernetes.io/managed-by", "angiplatform"))
+			Expect(metav1.IsControlledBy(deployment, myAppResource)).To(BeTrue())
 		})
 
-		// Test case for updating pods
-		It("should update pods when custom resource is updated", func() {
+		// Test case for rolling out spec changes
+		It("should update the Deployment template when custom resource is updated", func() {
 			// Setup
 			ctx := context.Background()
 			resourceName := "test-resource"
@@ -136,8 +233,11 @@ var _ = Describe("MyAppResource Controller", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Modify custom resource spec
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
 			myAppResource.Spec.Image.Repository = "new-repo" // Modify the image repository
-			myAppResource.Spec.Resources.CPURequest = "100m" // Modify CPU request
+			myAppResource.Spec.Image.Tag = "latest"
+			myAppResource.Spec.Resources.Requests.CPU = "100m" // Modify CPU request
+			myAppResource.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "registry"}}
 
 			// Update the custom resource
 			err = k8sClient.Update(ctx, myAppResource)
@@ -147,72 +247,1781 @@ var _ = Describe("MyAppResource Controller", func() {
 			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
 
-			// Verify that pods are updated
-			podList := &corev1.PodList{}
-			err = k8sClient.List(ctx, podList, client.InNamespace(typeNamespacedName.Namespace), client.MatchingLabels{"app": resourceName})
+			// Verify that the pod template is updated
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, typeNamespacedName, deployment)
 			Expect(err).NotTo(HaveOccurred())
-			for _, pod := range podList.Items {
-				for _, container := range pod.Spec.Containers {
-					if container.Name == "app-container" {
-						Expect(container.Image).To(Equal("new-repo:latest"))
-						cpuRequest, cpuFound := container.Resources.Requests[corev1.ResourceCPU]
-						Expect(cpuFound).To(BeTrue())                 // Check if CPU request is defined
-						Expect(cpuRequest.String()).To(Equal("100m")) // Use CPU request if defined
-						// You can add more assertions for other fields as needed
-						break
-					}
-				}
+			containers := deployment.Spec.Template.Spec.Containers
+			Expect(containers).To(HaveLen(1))
+			Expect(containers[0].Name).To(Equal("app-container"))
+			Expect(containers[0].Image).To(Equal("new-repo:latest"))
+			cpuRequest, cpuFound := containers[0].Resources.Requests[corev1.ResourceCPU]
+			Expect(cpuFound).To(BeTrue())                 // Check if CPU request is defined
+			Expect(cpuRequest.String()).To(Equal("100m")) // Use CPU request if defined
+			Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(ConsistOf(corev1.LocalObjectReference{Name: "registry"}))
+		})
+
+		// Test case for autoscaling
+		It("should leave the replica count to the autoscaler while autoscaling is on", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 1
+			myAppResource.Spec.Autoscaling = &myapigroupv1beta1.AutoscalingSpec{
+				MinReplicas:                       ptr.To(int32(2)),
+				MaxReplicas:                       6,
+				TargetMemoryUtilizationPercentage: ptr.To(int32(75)),
+				Behavior: &autoscalingv2.HorizontalPodAutoscalerBehavior{
+					ScaleDown: &autoscalingv2.HPAScalingRules{StabilizationWindowSeconds: ptr.To(int32(600))},
+				},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the autoscaler targets the app Deployment, which starts at the minimum
+			hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, hpa)).To(Succeed())
+			Expect(hpa.Spec.ScaleTargetRef).To(Equal(autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: resourceName}))
+			Expect(hpa.Spec.MinReplicas).To(Equal(ptr.To(int32(2))))
+			Expect(hpa.Spec.MaxReplicas).To(Equal(int32(6)))
+			Expect(hpa.Spec.Metrics).To(HaveLen(1))
+			Expect(hpa.Spec.Metrics[0].Resource.Name).To(Equal(corev1.ResourceMemory))
+			Expect(hpa.Spec.Behavior.ScaleDown.StabilizationWindowSeconds).To(Equal(ptr.To(int32(600))))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+
+			// Scale the Deployment through its scale subresource the way the autoscaler would
+			scale := &autoscalingv1.Scale{Spec: autoscalingv1.ScaleSpec{Replicas: 5}}
+			Expect(k8sClient.SubResource("scale").Update(ctx, deployment, client.WithSubResourceBody(scale), client.FieldOwner("horizontal-pod-autoscaler"))).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(5)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.App.Replicas).To(Equal(int32(5)))
+
+			// Envtest has no workload controllers, so report the scaled replicas by hand
+			markDeploymentScaled := func() {
+				Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+				deployment.Status.ObservedGeneration = deployment.Generation
+				deployment.Status.Replicas = *deployment.Spec.Replicas
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+
+			// Turning autoscaling off removes the autoscaler and restores the replica count
+			myAppResource.Spec.Autoscaling = nil
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			markDeploymentScaled()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, &autoscalingv2.HorizontalPodAutoscaler{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+
+			// The rest of the replicas are removed in batches of 25%
+			for _, expected := range []int32{2, 1} {
+				markDeploymentScaled()
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+				Expect(*deployment.Spec.Replicas).To(Equal(expected))
 			}
 		})
 
-		// Test case for deleting pods
-		It("should delete excess pods when replica count is decreased", func() {
+		// Test case for batched scale-down
+		It("should scale the app down in batches once the Deployment has caught up and the previous pods have terminated", func() {
 			// Setup
 			ctx := context.Background()
 			resourceName := "test-resource"
 			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			deployment := &appsv1.Deployment{}
 
-			// Reconcile the resource
+			// Envtest has no workload controllers, so report the scaled replicas by hand
+			markDeploymentScaled := func() {
+				Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+				deployment.Status.ObservedGeneration = deployment.Generation
+				deployment.Status.Replicas = *deployment.Spec.Replicas
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 6
+			myAppResource.Spec.MaxUnavailable = ptr.To(intstr.FromInt32(2))
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
 			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
 
-			// Modify custom resource spec to decrease replica count
-			myAppResource.Spec.ReplicaCount = 1 // Set replica count to 1
-			err = k8sClient.Update(ctx, myAppResource)
+			// Scale down to a single replica
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 1
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// Verify nothing is removed before the Deployment reports its replicas
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(6)))
+
+			// Verify only the first batch is removed and the reconcile checks back
+			markDeploymentScaled()
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+			Expect(deployment.Spec.Strategy.RollingUpdate.MaxUnavailable).To(Equal(ptr.To(intstr.FromInt32(2))))
+
+			// Verify the next batch waits for the Deployment to scale to the first one
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+			markDeploymentScaled()
+
+			// Envtest has no kubelet, so hold a pod of the batch in termination
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       fmt.Sprintf("%s-terminating", resourceName),
+					Namespace:  "default",
+					Labels:     map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "app"},
+					Finalizers: []string{"test.my.api.group.rama.angi.platform/hold"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app-container", Image: "ghcr.io/stefanprodan/podinfo:latest"}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, pod)).To(Succeed())
+
+			// Verify the next batch waits for the terminating pod
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
 
-			// Reconcile the resource again to trigger deletion of excess pods
+			// Verify the scale-down goes on once the pod is gone
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+			pod.Finalizers = nil
+			Expect(k8sClient.Update(ctx, pod)).To(Succeed())
+			Eventually(func() error {
+				return k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), &corev1.Pod{})
+			}).Should(Satisfy(errors.IsNotFound))
+
+			// A canary pod shutting down is not part of the Deployment
+			canaryPod := pod.DeepCopy()
+			canaryPod.ObjectMeta = metav1.ObjectMeta{
+				Name:       fmt.Sprintf("%s-canary-terminating", resourceName),
+				Namespace:  "default",
+				Labels:     map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "app", "track": "canary"},
+				Finalizers: []string{"test.my.api.group.rama.angi.platform/hold"},
+			}
+			Expect(k8sClient.Create(ctx, canaryPod)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, canaryPod)).To(Succeed())
 			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(canaryPod), canaryPod)).To(Succeed())
+			canaryPod.Finalizers = nil
+			Expect(k8sClient.Update(ctx, canaryPod)).To(Succeed())
 
-			// Verify that excess pods are deleted
-			podList := &corev1.PodList{}
-			err = k8sClient.List(ctx, podList, client.InNamespace(typeNamespacedName.Namespace), client.MatchingLabels{"app": resourceName})
+			// Verify the last batch is held until the status catches up again
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			markDeploymentScaled()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
-			Expect(len(podList.Items)).To(Equal(1)) // Expect only one pod to remain after deletion
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(1)))
 		})
 
-		// Test case for deploying Redis
-		It("should deploy Redis when enabled in custom resource", func() {
+		// Test case for disruption budgets
+		It("should limit voluntary disruptions of the app and Redis", func() {
 			// Setup
 			ctx := context.Background()
 			resourceName := "test-resource"
 			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}
 
-			// Enable Redis in custom resource
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 3
 			myAppResource.Spec.Redis.Enabled = true
-			err := k8sClient.Update(ctx, myAppResource)
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
 
-			// Reconcile the resource to trigger Redis deployment
+			// Verify the app may lose one pod at a time and the single Redis pod has no budget
+			pdb := &policyv1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, pdb)).To(Succeed())
+			Expect(pdb.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "app"}))
+			Expect(pdb.Spec.MaxUnavailable).To(Equal(ptr.To(intstr.FromInt32(1))))
+			Expect(pdb.Spec.MinAvailable).To(BeNil())
+			err = k8sClient.Get(ctx, redisKey, &policyv1.PodDisruptionBudget{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+
+			// Keep half of the app and the Redis pod up
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Disruption = myapigroupv1beta1.DisruptionSpec{
+				App:   myapigroupv1beta1.DisruptionBudget{MinAvailable: ptr.To(intstr.FromString("50%"))},
+				Redis: myapigroupv1beta1.DisruptionBudget{MinAvailable: ptr.To(intstr.FromInt32(1))},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
 			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
 
-			// Verify that Redis deployment is created
-			redisDeployment := &appsv1.Deployment{}
-			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}, redisDeployment)
+			Expect(k8sClient.Get(ctx, typeNamespacedName, pdb)).To(Succeed())
+			Expect(pdb.Spec.MinAvailable).To(Equal(ptr.To(intstr.FromString("50%"))))
+			Expect(pdb.Spec.MaxUnavailable).To(BeNil())
+			redisPDB := &policyv1.PodDisruptionBudget{}
+			Expect(k8sClient.Get(ctx, redisKey, redisPDB)).To(Succeed())
+			Expect(redisPDB.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "redis"}))
+			Expect(redisPDB.Spec.MinAvailable).To(Equal(ptr.To(intstr.FromInt32(1))))
+
+			// Turn the app budget off
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Disruption.App = myapigroupv1beta1.DisruptionBudget{Disabled: true}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
 			Expect(err).NotTo(HaveOccurred())
+			err = k8sClient.Get(ctx, typeNamespacedName, &policyv1.PodDisruptionBudget{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
 		})
 
-	})
-})
+		// Test case for the UI settings
+		It("should pass the UI settings to the app and roll it out on change", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the defaults reach podinfo through its environment
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			template := deployment.Spec.Template
+			Expect(template.Spec.Containers[0].Env).To(ConsistOf(
+				corev1.EnvVar{Name: "PODINFO_UI_COLOR", Value: "#" + myapigroupv1beta1.DefaultUIColor},
+				corev1.EnvVar{Name: "PODINFO_UI_MESSAGE", Value: myapigroupv1beta1.DefaultUIMessage},
+			))
+			Expect(template.Labels).NotTo(HaveKey("color"))
+			Expect(template.Annotations).NotTo(HaveKey("message"))
+
+			// Change the settings and map them to other variables
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.UI = myapigroupv1beta1.UserInterface{
+				Color:          "#ff0000",
+				Message:        "Hey there",
+				ColorEnvName:   "THEME_COLOR",
+				MessageEnvName: "GREETING",
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the new pod template, which the Deployment rolls out
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ConsistOf(
+				corev1.EnvVar{Name: "THEME_COLOR", Value: "#ff0000"},
+				corev1.EnvVar{Name: "GREETING", Value: "Hey there"},
+			))
+			Expect(deployment.Spec.Strategy.Type).To(Equal(appsv1.RollingUpdateDeploymentStrategyType))
+		})
+
+		It("should probe the app and Redis and leave out disabled probes", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the podinfo health endpoints are probed on its HTTP port
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			container := deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.LivenessProbe.HTTPGet.Path).To(Equal("/healthz"))
+			Expect(container.LivenessProbe.HTTPGet.Port).To(Equal(intstr.FromString("http")))
+			Expect(container.ReadinessProbe.HTTPGet.Path).To(Equal("/readyz"))
+			Expect(container.StartupProbe).To(BeNil())
+
+			// Verify Redis is pinged with the password passed to redis-cli
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}, redisStatefulSet)).To(Succeed())
+			redisContainer := redisStatefulSet.Spec.Template.Spec.Containers[0]
+			Expect(redisContainer.LivenessProbe.Exec.Command).To(ContainElement(ContainSubstring("redis-cli ping")))
+			Expect(redisContainer.ReadinessProbe.Exec.Command).To(ContainElement(ContainSubstring("redis-cli ping")))
+			Expect(redisContainer.Env).To(ContainElement(HaveField("Name", "REDISCLI_AUTH")))
+
+			// Disable the liveness probe and add a startup probe
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Probes = myapigroupv1beta1.ProbesSpec{
+				Liveness: &myapigroupv1beta1.Probe{Disabled: true},
+				Startup:  &myapigroupv1beta1.Probe{Probe: corev1.Probe{FailureThreshold: 30}},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			container = deployment.Spec.Template.Spec.Containers[0]
+			Expect(container.LivenessProbe).To(BeNil())
+			Expect(container.StartupProbe.HTTPGet.Path).To(Equal("/readyz"))
+			Expect(container.StartupProbe.FailureThreshold).To(Equal(int32(30)))
+
+			// A defaulted probe matches what the API server stores, so another
+			// pass leaves the Deployment alone
+			resourceVersion := deployment.ResourceVersion
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.ResourceVersion).To(Equal(resourceVersion))
+		})
+
+		It("should run a new image as a canary through its steps before promoting it", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			canaryKey := types.NamespacedName{Name: fmt.Sprintf("%s-canary", resourceName), Namespace: "default"}
+
+			// Envtest has no workload controllers, so report the pods as ready by hand
+			markDeploymentReady := func() {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+				replicas := *deployment.Spec.Replicas
+				deployment.Status = appsv1.DeploymentStatus{
+					ObservedGeneration: deployment.Generation,
+					Replicas:           replicas,
+					UpdatedReplicas:    replicas,
+					ReadyReplicas:      replicas,
+					AvailableReplicas:  replicas,
+				}
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+			markCanaryReady := func() {
+				replicaSet := &appsv1.ReplicaSet{}
+				Expect(k8sClient.Get(ctx, canaryKey, replicaSet)).To(Succeed())
+				replicas := *replicaSet.Spec.Replicas
+				replicaSet.Status = appsv1.ReplicaSetStatus{
+					ObservedGeneration: replicaSet.Generation,
+					Replicas:           replicas,
+					ReadyReplicas:      replicas,
+					AvailableReplicas:  replicas,
+				}
+				Expect(k8sClient.Status().Update(ctx, replicaSet)).To(Succeed())
+			}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 4
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.0"}
+			myAppResource.Spec.Rollout.Canary = &myapigroupv1beta1.CanaryStrategy{
+				Steps: []myapigroupv1beta1.CanaryStep{{Weight: 25}, {Weight: 50}},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// The first version has nothing to be compared with and is deployed directly
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			markDeploymentReady()
+			Expect(k8sClient.Get(ctx, canaryKey, &appsv1.ReplicaSet{})).To(Satisfy(errors.IsNotFound))
+
+			// Roll out a new tag
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image.Tag = "6.5.1"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the first step moves a quarter of the replicas to the canary
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.0"))
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(3)))
+			canary := &appsv1.ReplicaSet{}
+			Expect(k8sClient.Get(ctx, canaryKey, canary)).To(Succeed())
+			Expect(canary.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.1"))
+			Expect(canary.Spec.Template.Labels).To(HaveKeyWithValue("app.kubernetes.io/component", "app"))
+			Expect(*canary.Spec.Replicas).To(Equal(int32(1)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout.Phase).To(Equal(myapigroupv1beta1.RolloutPhaseProgressing))
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionCanary)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Reason).To(Equal("CanaryProgressing"))
+
+			// Verify the next step starts once the canary pods are ready and the
+			// stable pods have scaled down
+			markCanaryReady()
+			markDeploymentReady()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, canaryKey, canary)).To(Succeed())
+			Expect(*canary.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+
+			// Verify the last step promotes the new tag to the Deployment
+			markCanaryReady()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.1"))
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(4)))
+			Expect(k8sClient.Get(ctx, canaryKey, canary)).To(Succeed())
+
+			// Verify the canary is removed once the Deployment has rolled out
+			markDeploymentReady()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, canaryKey, canary)).To(Satisfy(errors.IsNotFound))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout).To(BeNil())
+			condition = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionCanary)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("CanaryPromoted"))
+		})
+
+		It("should abort a canary whose pods do not become ready", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 2
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.0"}
+			myAppResource.Spec.Rollout.Canary = &myapigroupv1beta1.CanaryStrategy{
+				Steps:            []myapigroupv1beta1.CanaryStep{{Weight: 50}},
+				ReadinessTimeout: &metav1.Duration{Duration: time.Millisecond},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Roll out a tag whose pods never become ready
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image.Tag = "broken"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			canaryKey := types.NamespacedName{Name: fmt.Sprintf("%s-canary", resourceName), Namespace: "default"}
+			Expect(k8sClient.Get(ctx, canaryKey, &appsv1.ReplicaSet{})).To(Succeed())
+
+			time.Sleep(10 * time.Millisecond)
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the canary is removed and the stable version gets all replicas back
+			Expect(k8sClient.Get(ctx, canaryKey, &appsv1.ReplicaSet{})).To(Satisfy(errors.IsNotFound))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.0"))
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout.Phase).To(Equal(myapigroupv1beta1.RolloutPhaseAborted))
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionCanary)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("CanaryAborted"))
+
+			// Verify the aborted revision is not tried again
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, canaryKey, &appsv1.ReplicaSet{})).To(Satisfy(errors.IsNotFound))
+		})
+
+		It("should switch the Service to a blue/green preview once it is approved", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			previewKey := types.NamespacedName{Name: fmt.Sprintf("%s-preview", resourceName), Namespace: "default"}
+			revisionLabel := "my.api.group.rama.angi.platform/revision"
+
+			// Envtest has no workload controllers, so report the pods as ready by hand
+			markDeploymentReady := func() {
+				deployment := &appsv1.Deployment{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+				replicas := *deployment.Spec.Replicas
+				deployment.Status = appsv1.DeploymentStatus{
+					ObservedGeneration: deployment.Generation,
+					Replicas:           replicas,
+					UpdatedReplicas:    replicas,
+					ReadyReplicas:      replicas,
+					AvailableReplicas:  replicas,
+				}
+				Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			}
+			markPreviewReady := func() {
+				replicaSet := &appsv1.ReplicaSet{}
+				Expect(k8sClient.Get(ctx, previewKey, replicaSet)).To(Succeed())
+				replicas := *replicaSet.Spec.Replicas
+				replicaSet.Status = appsv1.ReplicaSetStatus{
+					ObservedGeneration: replicaSet.Generation,
+					Replicas:           replicas,
+					ReadyReplicas:      replicas,
+					AvailableReplicas:  replicas,
+				}
+				Expect(k8sClient.Status().Update(ctx, replicaSet)).To(Succeed())
+			}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 2
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.0"}
+			myAppResource.Spec.Rollout.BlueGreen = &myapigroupv1beta1.BlueGreenStrategy{
+				RollbackWindow: &metav1.Duration{Duration: time.Hour},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			markDeploymentReady()
+
+			// Verify both Services select the running version
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			blue := deployment.Spec.Template.Labels[revisionLabel]
+			Expect(blue).NotTo(BeEmpty())
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, blue))
+			previewService := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, previewKey, previewService)).To(Succeed())
+			Expect(previewService.Spec.Selector).To(HaveKeyWithValue(revisionLabel, blue))
+
+			// Roll out a new tag
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image.Tag = "6.5.1"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the new version runs in full behind the preview Service only
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.0"))
+			Expect(*deployment.Spec.Replicas).To(Equal(int32(2)))
+			preview := &appsv1.ReplicaSet{}
+			Expect(k8sClient.Get(ctx, previewKey, preview)).To(Succeed())
+			Expect(preview.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.1"))
+			Expect(*preview.Spec.Replicas).To(Equal(int32(2)))
+			green := preview.Spec.Template.Labels[revisionLabel]
+			Expect(green).NotTo(Equal(blue))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, blue))
+			Expect(k8sClient.Get(ctx, previewKey, previewService)).To(Succeed())
+			Expect(previewService.Spec.Selector).To(HaveKeyWithValue(revisionLabel, green))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout.Phase).To(Equal(myapigroupv1beta1.RolloutPhasePreview))
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal("PreviewStarting"))
+
+			// Verify a ready preview waits for the approval
+			markPreviewReady()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, blue))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			condition = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+			Expect(condition.Reason).To(Equal("AwaitingPromotion"))
+
+			// Approve the preview
+			myAppResource.Annotations = map[string]string{myapigroupv1beta1.PromoteAnnotation: myAppResource.Status.Rollout.Revision}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the traffic moves to the new version while the old one is kept
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, green))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.0"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout.Phase).To(Equal(myapigroupv1beta1.RolloutPhasePromoted))
+			condition = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+			Expect(condition.Reason).To(Equal("RollbackWindow"))
+
+			// Verify the Deployment moves to the new version once the rollback window is over
+			myAppResource.Spec.Rollout.BlueGreen.RollbackWindow = &metav1.Duration{Duration: 0}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.1"))
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue(revisionLabel, green))
+			Expect(k8sClient.Get(ctx, previewKey, preview)).To(Succeed())
+
+			// Verify the preview is removed once the Deployment has rolled out
+			markDeploymentReady()
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, previewKey, preview)).To(Satisfy(errors.IsNotFound))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, green))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout).To(BeNil())
+			condition = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("Promoted"))
+		})
+
+		It("should move the traffic back when a promoted blue/green rollout is reverted", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			previewKey := types.NamespacedName{Name: fmt.Sprintf("%s-preview", resourceName), Namespace: "default"}
+			revisionLabel := "my.api.group.rama.angi.platform/revision"
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.0"}
+			myAppResource.Spec.Rollout.BlueGreen = &myapigroupv1beta1.BlueGreenStrategy{
+				AutoPromoteAfter: &metav1.Duration{Duration: 0},
+				RollbackWindow:   &metav1.Duration{Duration: time.Hour},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			blue := deployment.Spec.Template.Labels[revisionLabel]
+
+			// Roll out a new tag and report its preview as ready
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image.Tag = "6.5.1"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			preview := &appsv1.ReplicaSet{}
+			Expect(k8sClient.Get(ctx, previewKey, preview)).To(Succeed())
+			preview.Status = appsv1.ReplicaSetStatus{
+				ObservedGeneration: preview.Generation,
+				Replicas:           *preview.Spec.Replicas,
+				ReadyReplicas:      *preview.Spec.Replicas,
+			}
+			Expect(k8sClient.Status().Update(ctx, preview)).To(Succeed())
+
+			// Verify the preview is promoted without an approval
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, preview.Spec.Template.Labels[revisionLabel]))
+
+			// Revert the tag within the rollback window
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Image.Tag = "6.5.0"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the old version takes the traffic again and the preview is dropped
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(HaveKeyWithValue(revisionLabel, blue))
+			Expect(k8sClient.Get(ctx, previewKey, &appsv1.ReplicaSet{})).To(Satisfy(errors.IsNotFound))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Rollout).To(BeNil())
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+			Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(condition.Reason).To(Equal("RolledBack"))
+		})
+
+		// Test case for migrating pods created by older controller versions
+		It("should drain legacy pods once the Deployment is available", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			// Create a bare pod the way earlier controller versions did
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			legacyPod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-0", resourceName),
+					Namespace: "default",
+					Labels:    map[string]string{"app": resourceName},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "app-container", Image: "ghcr.io/stefanprodan/podinfo:latest"}},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(myAppResource, legacyPod, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacyPod)).To(Succeed())
+
+			// No replicas are requested, so the Deployment is available straight away
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+
+			// Envtest has no Deployment controller, so mark the rollout as observed
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			deployment.Status.ObservedGeneration = deployment.Generation
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify that the legacy pod is being removed
+			pod := &corev1.Pod{}
+			err = k8sClient.Get(ctx, client.ObjectKeyFromObject(legacyPod), pod)
+			if err == nil {
+				Expect(pod.DeletionTimestamp).NotTo(BeNil())
+			} else {
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			}
+		})
+
+		// Test case for reporting status
+		It("should populate the status after reconciling", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 2
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.4"}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// Reconcile the resource
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the replica counts, image and conditions
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			status := myAppResource.Status
+			Expect(status.ObservedGeneration).To(Equal(myAppResource.Generation))
+			Expect(status.App.Replicas).To(Equal(int32(2)))
+			Expect(status.App.ReadyReplicas).To(BeZero())
+			Expect(status.Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.4"))
+			Expect(meta.IsStatusConditionFalse(status.Conditions, myapigroupv1beta1.ConditionAvailable)).To(BeTrue())
+			Expect(meta.IsStatusConditionTrue(status.Conditions, myapigroupv1beta1.ConditionProgressing)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(status.Conditions, myapigroupv1beta1.ConditionDegraded)).To(BeTrue())
+			Expect(meta.FindStatusCondition(status.Conditions, myapigroupv1beta1.ConditionRedisReady)).NotTo(BeNil())
+		})
+
+		// Test case for a spec that fails validation
+		It("should report an invalid spec without touching the workloads or requeueing", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			resourceVersion := deployment.ResourceVersion
+
+			// Envtest runs without the webhooks, so a malformed quantity is stored
+			// the way it was before the validating webhook was installed
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(reconcile.Result{}))
+
+			// Verify the problem is reported and the Deployment is left alone
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionSpecInvalid)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+			Expect(condition.Message).To(ContainSubstring("spec.resources.requests.cpu"))
+			degraded := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionDegraded)
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal("SpecInvalid"))
+			Expect(recordedEvents(recorder)).To(ContainElement(HavePrefix("Warning SpecInvalid ")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.ResourceVersion).To(Equal(resourceVersion))
+
+			// Fix the spec
+			myAppResource.Spec.Resources.Requests.CPU = "200m"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the change is rolled out and the condition clears
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionSpecInvalid)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionDegraded)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Resources.Requests.Cpu().String()).To(Equal("200m"))
+		})
+
+		// Test case for the desired state the owned objects are rendered from
+		It("should parse the quantities of the spec into the desired state", func() {
+			spec := myapigroupv1beta1.MyAppResourceSpec{}
+			spec.Resources.Requests.CPU = "250m"
+			spec.Redis.Sentinel = &myapigroupv1beta1.RedisSentinelSpec{}
+			spec.Redis.Sentinel.Resources.Limits.Memory = "64Mi"
+			spec.Redis.Persistence = &myapigroupv1beta1.RedisPersistenceSpec{Size: "2Gi"}
+
+			desired, errs := newDesiredState(&spec, field.NewPath("spec"))
+			Expect(errs).To(BeEmpty())
+			Expect(desired.appResources.Requests.Cpu().String()).To(Equal("250m"))
+			Expect(desired.appResources.Requests).NotTo(HaveKey(corev1.ResourceMemory))
+			Expect(desired.sentinelResources.Limits.Memory().String()).To(Equal("64Mi"))
+			Expect(desired.redisStorage.String()).To(Equal("2Gi"))
+
+			// A quantity that does not parse is reported instead of left out
+			spec.Redis.Resources.Limits.CPU = "100mm"
+			spec.Redis.Persistence.Size = "lots"
+			_, errs = newDesiredState(&spec, field.NewPath("spec"))
+			Expect(errs).To(HaveLen(2))
+			Expect(errs[0].Field).To(Equal("spec.redis.resources.limits.cpu"))
+			Expect(errs[1].Field).To(Equal("spec.redis.persistence.size"))
+		})
+
+		// Test case for the events recorded on the resource
+		It("should record events only when objects or conditions change", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recordedEvents(recorder)).To(ContainElements(
+				fmt.Sprintf("Normal Created Created Deployment %s", resourceName),
+				fmt.Sprintf("Normal Created Created Service %s", resourceName),
+			))
+
+			// A reconcile that finds everything in place records nothing
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recordedEvents(recorder)).To(BeEmpty())
+
+			// Scaling the app is recorded
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			replicas := myAppResource.Spec.ReplicaCount
+			myAppResource.Spec.ReplicaCount = replicas + 2
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recordedEvents(recorder)).To(ContainElement(
+				fmt.Sprintf("Normal Scaled Scaled Deployment %s from %d to %d replicas", resourceName, replicas, replicas+2),
+			))
+
+			// An invalid spec is a Warning, recorded once however often it is reconciled
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			for i := 0; i < 3; i++ {
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			events := recordedEvents(recorder)
+			Expect(events).To(HaveLen(1))
+			Expect(events[0]).To(HavePrefix("Warning SpecInvalid Degraded: "))
+
+			// Recovering is recorded as a Normal event
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Resources.Requests.CPU = "200m"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(recordedEvents(recorder)).To(ContainElement("Normal Reconciled Degraded: All resources are reconciled"))
+		})
+
+		// Test case for the metrics reported for the resource
+		It("should report metrics labelled with the namespace and name of the resource", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			created := testutil.ToFloat64(podsCreated.WithLabelValues("default", resourceName, "app"))
+			failures := testutil.ToFloat64(specValidationFailures.WithLabelValues("default", resourceName))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 3
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Envtest runs no pods, so none of the replicas are ready
+			Expect(testutil.ToFloat64(desiredReplicas.WithLabelValues("default", resourceName))).To(Equal(3.0))
+			Expect(testutil.ToFloat64(readyReplicas.WithLabelValues("default", resourceName))).To(BeZero())
+			Expect(testutil.ToFloat64(podsCreated.WithLabelValues("default", resourceName, "app"))).To(Equal(created + 3))
+			Expect(testutil.ToFloat64(specInvalid.WithLabelValues("default", resourceName))).To(BeZero())
+
+			// Every reconcile of an invalid spec counts as a failure
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			for i := 0; i < 2; i++ {
+				_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(testutil.ToFloat64(specValidationFailures.WithLabelValues("default", resourceName))).To(Equal(failures + 2))
+			Expect(testutil.ToFloat64(specInvalid.WithLabelValues("default", resourceName))).To(Equal(1.0))
+		})
+
+		// Test case for exposing the app
+		It("should expose the app through a Service and an optional Ingress", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			className := "nginx"
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Service = myapigroupv1beta1.ServiceSpec{
+				Port:        80,
+				Type:        corev1.ServiceTypeClusterIP,
+				Annotations: map[string]string{"example.com/team": "web"},
+			}
+			myAppResource.Spec.Ingress = &myapigroupv1beta1.IngressSpec{
+				Host:          "podinfo.example.com",
+				Path:          "/",
+				TLSSecretName: "podinfo-tls",
+				ClassName:     &className,
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the Service targets the app pods on the podinfo port
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "app"}))
+			Expect(service.Spec.Ports).To(HaveLen(1))
+			Expect(service.Spec.Ports[0].Port).To(Equal(int32(80)))
+			Expect(service.Spec.Ports[0].TargetPort.StrVal).To(Equal("http"))
+			Expect(service.Annotations).To(HaveKeyWithValue("example.com/team", "web"))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Ports).To(ContainElement(HaveField("ContainerPort", int32(9898))))
+
+			// Verify the Ingress routes the host to the Service
+			ingress := &networkingv1.Ingress{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ingress)).To(Succeed())
+			Expect(ingress.Spec.IngressClassName).To(Equal(&className))
+			Expect(ingress.Spec.Rules).To(HaveLen(1))
+			Expect(ingress.Spec.Rules[0].Host).To(Equal("podinfo.example.com"))
+			Expect(ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name).To(Equal(resourceName))
+			Expect(ingress.Spec.TLS).To(Equal([]networkingv1.IngressTLS{{Hosts: []string{"podinfo.example.com"}, SecretName: "podinfo-tls"}}))
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.App.Endpoint).To(Equal(fmt.Sprintf("%s.default.svc:80", resourceName)))
+			Expect(myAppResource.Status.App.URL).To(Equal("https://podinfo.example.com/"))
+
+			// Drop the annotation and the Ingress, keeping annotations set by others
+			service.Annotations["example.com/other"] = "kept"
+			Expect(k8sClient.Update(ctx, service, client.FieldOwner("example-operator"))).To(Succeed())
+			myAppResource.Spec.Service.Annotations = nil
+			myAppResource.Spec.Ingress = nil
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Annotations).NotTo(HaveKey("example.com/team"))
+			Expect(service.Annotations).To(HaveKeyWithValue("example.com/other", "kept"))
+			err = k8sClient.Get(ctx, typeNamespacedName, &networkingv1.Ingress{})
+			Expect(errors.IsNotFound(err)).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.App.URL).To(BeEmpty())
+		})
+
+		// Test case for fields set by other field managers
+		It("should keep fields of other field managers and report conflicts instead of overwriting them", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			conflict := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionFieldConflict)
+			Expect(conflict).NotTo(BeNil())
+			Expect(conflict.Status).To(Equal(metav1.ConditionFalse))
+
+			// Every owned object is applied by the field manager of the controller
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.ManagedFields).To(ContainElement(SatisfyAll(
+				HaveField("Manager", "myappresource-controller"),
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+			)))
+
+			// A mesh injects an annotation into the pod template
+			patch := client.MergeFrom(deployment.DeepCopy())
+			deployment.Spec.Template.Annotations = mergeStringMap(deployment.Spec.Template.Annotations, map[string]string{"sidecar.example.com/inject": "true"})
+			Expect(k8sClient.Patch(ctx, deployment, patch, client.FieldOwner("example-mesh"))).To(Succeed())
+			resourceVersion := deployment.ResourceVersion
+
+			// Verify the annotation is kept without rolling the Deployment again
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue("sidecar.example.com/inject", "true"))
+			Expect(deployment.ResourceVersion).To(Equal(resourceVersion))
+
+			// Someone edits the target port of the app Service
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			service.Spec.Ports[0].TargetPort = intstr.FromInt32(8080)
+			Expect(k8sClient.Update(ctx, service, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+			// Verify the conflict is reported and the edit is left in place
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Ports[0].TargetPort).To(Equal(intstr.FromInt32(8080)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			conflict = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionFieldConflict)
+			Expect(conflict.Status).To(Equal(metav1.ConditionTrue))
+			Expect(conflict.Message).To(ContainSubstring(fmt.Sprintf("Service %s", resourceName)))
+			Expect(conflict.Message).To(ContainSubstring("kubectl-edit"))
+			degraded := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionDegraded)
+			Expect(degraded.Status).To(Equal(metav1.ConditionTrue))
+			Expect(degraded.Reason).To(Equal("FieldConflict"))
+
+			// Verify a pass that applies nothing for an invalid spec keeps the conflict
+			cpu := myAppResource.Spec.Resources.Requests.CPU
+			myAppResource.Spec.Resources.Requests.CPU = "100mm"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionFieldConflict)).To(BeTrue())
+			degraded = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionDegraded)
+			Expect(degraded.Reason).To(Equal("SpecInvalid"))
+			myAppResource.Spec.Resources.Requests.CPU = cpu
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// Verify the conflict clears once the edit is undone
+			service.Spec.Ports[0].TargetPort = intstr.FromString("http")
+			Expect(k8sClient.Update(ctx, service, client.FieldOwner("kubectl-edit"))).To(Succeed())
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(meta.IsStatusConditionFalse(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionFieldConflict)).To(BeTrue())
+			Expect(meta.IsStatusConditionFalse(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionDegraded)).To(BeTrue())
+
+			// Another controller already controls an Ingress of the same name
+			owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other-controller", Namespace: "default"}}
+			Expect(k8sClient.Create(ctx, owner)).To(Succeed())
+			ingress := &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default"},
+				Spec: networkingv1.IngressSpec{DefaultBackend: &networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{Name: "other", Port: networkingv1.ServiceBackendPort{Number: 80}},
+				}},
+			}
+			Expect(controllerutil.SetControllerReference(owner, ingress, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, ingress)).To(Succeed())
+			myAppResource.Spec.Ingress = &myapigroupv1beta1.IngressSpec{Host: "podinfo.example.com", Path: "/"}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			// Verify the Ingress is left alone and reported as a conflict
+			result, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(time.Minute))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, ingress)).To(Succeed())
+			Expect(ingress.Spec.Rules).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			conflict = meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionFieldConflict)
+			Expect(conflict.Status).To(Equal(metav1.ConditionTrue))
+			Expect(conflict.Message).To(ContainSubstring(fmt.Sprintf("Ingress %s", resourceName)))
+			Expect(k8sClient.Delete(ctx, ingress)).To(Succeed())
+			Expect(k8sClient.Delete(ctx, owner)).To(Succeed())
+		})
+
+		// Test case for deploying Redis
+		It("should deploy Redis when enabled in custom resource", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			// Enable Redis in custom resource
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			err := k8sClient.Update(ctx, myAppResource)
+			Expect(err).NotTo(HaveOccurred())
+
+			// Reconcile the resource to trigger Redis deployment
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify that Redis statefulset is created
+			redisStatefulSet := &appsv1.StatefulSet{}
+			err = k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}, redisStatefulSet)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(redisStatefulSet.Spec.ServiceName).To(Equal(fmt.Sprintf("%s-redis-headless", resourceName)))
+			Expect(redisStatefulSet.Spec.VolumeClaimTemplates).To(BeEmpty())
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].Args).To(ContainElements("--appendonly", "no"))
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis-headless", resourceName)}, &corev1.Service{})).To(Succeed())
+		})
+
+		// Test case for connecting the app to Redis
+		It("should expose Redis through a Service and inject its address into the app", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			endpoint := fmt.Sprintf("%s-redis.default.svc:6379", resourceName)
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the Service selects the Redis pods only
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}, service)).To(Succeed())
+			Expect(service.Spec.Type).To(Equal(corev1.ServiceTypeClusterIP))
+			Expect(service.Spec.Selector).To(HaveKeyWithValue("app.kubernetes.io/component", "redis"))
+			Expect(metav1.IsControlledBy(service, myAppResource)).To(BeTrue())
+
+			// Verify the app container gets the address
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+				Name:  myapigroupv1beta1.DefaultRedisAddressEnv,
+				Value: "tcp://" + endpoint,
+			}))
+
+			// Verify the endpoint is published in the status
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Redis.Endpoint).To(Equal(endpoint))
+
+			// Rename the variable and check the old one is dropped
+			myAppResource.Spec.Redis.AddressEnvName = "REDIS_URL"
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			env := deployment.Spec.Template.Spec.Containers[0].Env
+			Expect(env).To(ContainElement(corev1.EnvVar{Name: "REDIS_URL", Value: "tcp://" + endpoint}))
+			Expect(env).NotTo(ContainElement(HaveField("Name", myapigroupv1beta1.DefaultRedisAddressEnv)))
+		})
+
+		// Test case for the generated Redis password
+		It("should generate a Redis password and rotate it in order on request", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}
+			secretKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis-auth", resourceName)}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the Secret and that both workloads read the password from it
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			password := secret.Data["password"]
+			Expect(password).NotTo(BeEmpty())
+			Expect(metav1.IsControlledBy(secret, myAppResource)).To(BeTrue())
+
+			passwordRef := &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: secretKey.Name},
+				Key:                  "password",
+			}}
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			redisContainer := redisStatefulSet.Spec.Template.Spec.Containers[0]
+			Expect(redisContainer.Args).To(ContainElements("--requirepass", "$(REDIS_PASSWORD)"))
+			Expect(redisContainer.Env).To(ContainElement(corev1.EnvVar{Name: "REDIS_PASSWORD", ValueFrom: passwordRef}))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{
+				Name:      myapigroupv1beta1.DefaultRedisPasswordEnv,
+				ValueFrom: passwordRef,
+			}))
+			checksum := redisStatefulSet.Spec.Template.Annotations[redisAuthChecksumAnnotation]
+			Expect(checksum).NotTo(BeEmpty())
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue(redisAuthChecksumAnnotation, checksum))
+
+			// Request a rotation
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Annotations = map[string]string{myapigroupv1beta1.RotateRedisPasswordAnnotation: "1"}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Redis restarts first while the app keeps running with the old password
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.Data["password"]).NotTo(Equal(password))
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			rotated := redisStatefulSet.Spec.Template.Annotations[redisAuthChecksumAnnotation]
+			Expect(rotated).NotTo(Equal(checksum))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue(redisAuthChecksumAnnotation, checksum))
+
+			// The app restarts once Redis has rolled out
+			redisStatefulSet.Status.ObservedGeneration = redisStatefulSet.Generation
+			redisStatefulSet.Status.Replicas = 1
+			redisStatefulSet.Status.ReadyReplicas = 1
+			redisStatefulSet.Status.UpdatedReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, redisStatefulSet)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Annotations).To(HaveKeyWithValue(redisAuthChecksumAnnotation, rotated))
+
+			// Verify the rotation time is reported and the same request is not repeated
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Redis.PasswordSecret).To(Equal(secretKey.Name))
+			Expect(myAppResource.Status.Redis.LastPasswordRotationTime).NotTo(BeNil())
+			rotatedPassword := secret.Data["password"]
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.Data["password"]).To(Equal(rotatedPassword))
+
+			// Clear the replica count so the teardown in AfterEach can finish
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			redisStatefulSet.Status = appsv1.StatefulSetStatus{}
+			Expect(k8sClient.Status().Update(ctx, redisStatefulSet)).To(Succeed())
+		})
+
+		// Test case for Redis drift
+		It("should restore Redis statefulset fields changed outside the controller", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			myAppResource.Spec.Redis.Resources = myapigroupv1beta1.ResourceRequirements{
+				Limits: myapigroupv1beta1.ResourceList{Memory: "128Mi"},
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// A pass without changes leaves the statefulset alone
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			resourceVersion := redisStatefulSet.ResourceVersion
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			Expect(redisStatefulSet.ResourceVersion).To(Equal(resourceVersion))
+
+			// Change the statefulset by hand
+			replicas := int32(3)
+			redisStatefulSet.Spec.Replicas = &replicas
+			redisStatefulSet.Labels["app.kubernetes.io/component"] = "cache"
+			redisStatefulSet.Spec.Template.Spec.Containers[0].Image = "redis:6"
+			redisStatefulSet.Spec.Template.Spec.Containers[0].Resources = corev1.ResourceRequirements{}
+			Expect(k8sClient.Update(ctx, redisStatefulSet)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the spec wins again
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			Expect(*redisStatefulSet.Spec.Replicas).To(Equal(int32(1)))
+			Expect(redisStatefulSet.Labels).To(HaveKeyWithValue("app.kubernetes.io/component", "redis"))
+			container := redisStatefulSet.Spec.Template.Spec.Containers[0]
+			Expect(container.Image).To(Equal("redis:7.2"))
+			Expect(container.Resources.Limits.Memory().String()).To(Equal("128Mi"))
+		})
+
+		// Test case for disabling Redis
+		It("should remove Redis when it is disabled and report what was removed", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Disable Redis
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = false
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the Redis objects are gone and the app no longer uses Redis
+			removed := []client.Object{
+				&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-redis", resourceName)}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-redis", resourceName)}},
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-redis-headless", resourceName)}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("%s-redis-auth", resourceName)}},
+			}
+			for _, obj := range removed {
+				err := k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: obj.GetName()}, obj)
+				Expect(errors.IsNotFound(err)).To(BeTrue(), "%T %s should be removed", obj, obj.GetName())
+			}
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Env).To(ConsistOf(
+				HaveField("Name", myapigroupv1beta1.DefaultUIColorEnv),
+				HaveField("Name", myapigroupv1beta1.DefaultUIMessageEnv),
+			))
+
+			// Verify the status reports the removed objects, also on later passes
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Redis.Removed).To(ConsistOf(
+				fmt.Sprintf("StatefulSet/%s-redis", resourceName),
+				fmt.Sprintf("Service/%s-redis", resourceName),
+				fmt.Sprintf("Service/%s-redis-headless", resourceName),
+				fmt.Sprintf("Secret/%s-redis-auth", resourceName),
+			))
+			condition := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionRedisReady)
+			Expect(condition).NotTo(BeNil())
+			Expect(condition.Reason).To(Equal("RedisDisabled"))
+		})
+
+		// Test case for persistent Redis storage
+		It("should claim a volume per Redis replica when persistence is enabled", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+
+			storageClass := "fast"
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			myAppResource.Spec.Redis.Persistence = &myapigroupv1beta1.RedisPersistenceSpec{
+				Size:             "2Gi",
+				StorageClassName: &storageClass,
+			}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}, redisStatefulSet)).To(Succeed())
+			Expect(redisStatefulSet.Spec.VolumeClaimTemplates).To(HaveLen(1))
+			claim := redisStatefulSet.Spec.VolumeClaimTemplates[0]
+			Expect(claim.Spec.StorageClassName).To(Equal(&storageClass))
+			Expect(claim.Spec.AccessModes).To(ConsistOf(corev1.ReadWriteOnce))
+			Expect(claim.Spec.Resources.Requests.Storage().String()).To(Equal("2Gi"))
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].Args).To(ContainElements("--appendonly", "yes", "--save", myapigroupv1beta1.DefaultRedisSave))
+		})
+
+		// Test case for Redis with Sentinel
+		It("should follow the primary Sentinel reports in sentinel mode", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisName := fmt.Sprintf("%s-redis", resourceName)
+			sentinel := &fakeSentinel{host: fmt.Sprintf("%s-0.%s-headless.default.svc", redisName, redisName)}
+			reconciler.Sentinel = sentinel
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			myAppResource.Spec.Redis.Mode = myapigroupv1beta1.RedisModeSentinel
+			replicas := int32(2)
+			myAppResource.Spec.Redis.ReplicaCount = &replicas
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+
+			// Verify the Sentinels run next to Redis and the Redis Service only selects the primary
+			sentinelStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-sentinel", redisName)}, sentinelStatefulSet)).To(Succeed())
+			Expect(*sentinelStatefulSet.Spec.Replicas).To(Equal(int32(3)))
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-sentinel", redisName)}, &corev1.Service{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-sentinel-headless", redisName)}, &corev1.Service{})).To(Succeed())
+			redisService := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: redisName}, redisService)).To(Succeed())
+			Expect(redisService.Spec.Selector).To(HaveKeyWithValue("redis-role", "primary"))
+
+			// Envtest has no workload controllers, so create the Redis pods by hand
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: redisName}, redisStatefulSet)).To(Succeed())
+			Expect(redisStatefulSet.Spec.Template.Spec.Containers[0].Command).To(HaveExactElements("sh", "-c", redisServerScript, "redis-server"))
+			for i := 0; i < 2; i++ {
+				pod := &corev1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      fmt.Sprintf("%s-%d", redisName, i),
+						Namespace: "default",
+						Labels:    map[string]string{"app.kubernetes.io/name": "myappresource", "app.kubernetes.io/instance": resourceName, "app.kubernetes.io/component": "redis"},
+					},
+					Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "redis", Image: "redis:7.2"}}},
+				}
+				Expect(controllerutil.SetControllerReference(redisStatefulSet, pod, k8sClient.Scheme())).To(Succeed())
+				Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+				DeferCleanup(k8sClient.Delete, ctx, pod)
+			}
+
+			roles := func() map[string]string {
+				roles := map[string]string{}
+				for i := 0; i < 2; i++ {
+					pod := &corev1.Pod{}
+					Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-%d", redisName, i)}, pod)).To(Succeed())
+					roles[pod.Name] = pod.Labels["redis-role"]
+				}
+				return roles
+			}
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles()).To(Equal(map[string]string{redisName + "-0": "primary", redisName + "-1": "replica"}))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Redis.Primary).To(Equal(redisName + "-0"))
+			Expect(myAppResource.Status.Redis.Failovers).To(BeZero())
+			Expect(myAppResource.Status.Redis.Sentinel).NotTo(BeNil())
+			Expect(myAppResource.Status.Redis.Sentinel.Replicas).To(Equal(int32(3)))
+
+			// Fail over to the second pod
+			sentinel.host = fmt.Sprintf("%s-1.%s-headless.default.svc", redisName, redisName)
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles()).To(Equal(map[string]string{redisName + "-0": "replica", redisName + "-1": "primary"}))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Status.Redis.Primary).To(Equal(redisName + "-1"))
+			Expect(myAppResource.Status.Redis.Failovers).To(Equal(int32(1)))
+
+			// Keep the last known primary while Sentinel cannot be reached
+			sentinel.err = fmt.Errorf("connection refused")
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(roles()).To(Equal(map[string]string{redisName + "-0": "replica", redisName + "-1": "primary"}))
+		})
+
+		// Test case for migrating Redis from a Deployment
+		It("should replace a Redis deployment once the statefulset is ready", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}
+
+			// Create the Redis deployment the way earlier controller versions did
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.Redis.Enabled = true
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+			replicas := int32(1)
+			legacyDeployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: redisKey.Name, Namespace: redisKey.Namespace},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": resourceName}},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": resourceName}},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "redis", Image: "redis:latest"}}},
+					},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(myAppResource, legacyDeployment, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacyDeployment)).To(Succeed())
+
+			// The deployment keeps serving until the statefulset is ready
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+			Expect(k8sClient.Get(ctx, redisKey, &appsv1.Deployment{})).To(Succeed())
+
+			// Envtest has no StatefulSet controller, so mark the replica as ready
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			redisStatefulSet.Status.ObservedGeneration = redisStatefulSet.Generation
+			redisStatefulSet.Status.Replicas = 1
+			redisStatefulSet.Status.ReadyReplicas = 1
+			redisStatefulSet.Status.UpdatedReplicas = 1
+			Expect(k8sClient.Status().Update(ctx, redisStatefulSet)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			err = k8sClient.Get(ctx, redisKey, deployment)
+			if err == nil {
+				Expect(deployment.DeletionTimestamp).NotTo(BeNil())
+			} else {
+				Expect(errors.IsNotFound(err)).To(BeTrue())
+			}
+
+			// Clear the replica count so the teardown in AfterEach can finish
+			redisStatefulSet.Status = appsv1.StatefulSetStatus{}
+			Expect(k8sClient.Status().Update(ctx, redisStatefulSet)).To(Succeed())
+		})
+
+		// Test case for moving to the current labels
+		It("should recreate a Deployment with the labels of earlier versions once its pods are relabelled", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			legacyLabels := map[string]string{"app": resourceName, "component": "app"}
+			currentLabels := map[string]string{
+				"app.kubernetes.io/name":      "myappresource",
+				"app.kubernetes.io/instance":  resourceName,
+				"app.kubernetes.io/component": "app",
+			}
+
+			// Create the app deployment the way earlier controller versions did
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			replicas := int32(2)
+			legacyDeployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName, Namespace: "default", Labels: legacyLabels},
+				Spec: appsv1.DeploymentSpec{
+					Replicas: &replicas,
+					Selector: &metav1.LabelSelector{MatchLabels: legacyLabels},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: legacyLabels},
+						Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "app-container", Image: "ghcr.io/stefanprodan/podinfo:latest"}}},
+					},
+				},
+			}
+			Expect(controllerutil.SetControllerReference(myAppResource, legacyDeployment, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, legacyDeployment)).To(Succeed())
+
+			result, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).NotTo(BeZero())
+
+			// Verify the pods are relabelled first while the Service keeps selecting them
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Selector.MatchLabels).To(Equal(legacyLabels))
+			for k, v := range currentLabels {
+				Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue(k, v))
+				Expect(deployment.Labels).To(HaveKeyWithValue(k, v))
+			}
+			Expect(deployment.Spec.Template.Labels).To(HaveKeyWithValue("app", resourceName))
+			Expect(deployment.Labels).NotTo(HaveKey("app"))
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(legacyLabels))
+
+			// Envtest has no Deployment controller, so mark the relabelled pods as rolled out
+			deployment.Status.ObservedGeneration = deployment.Generation
+			deployment.Status.Replicas = *deployment.Spec.Replicas
+			deployment.Status.UpdatedReplicas = *deployment.Spec.Replicas
+			deployment.Status.AvailableReplicas = *deployment.Spec.Replicas
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the deployment is deleted with its pods left for the new one
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.DeletionTimestamp).NotTo(BeNil())
+			Expect(deployment.Finalizers).To(ContainElement(metav1.FinalizerOrphanDependents))
+
+			// Envtest has no garbage collector, so finish the deletion by hand
+			deployment.Finalizers = nil
+			Expect(k8sClient.Update(ctx, deployment)).To(Succeed())
+			Eventually(func() bool {
+				return errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, &appsv1.Deployment{}))
+			}).Should(BeTrue())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Verify the deployment and the Service select by the current labels only
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(deployment.Spec.Selector.MatchLabels).To(Equal(currentLabels))
+			Expect(deployment.Spec.Template.Labels).NotTo(HaveKey("app"))
+			Expect(deployment.Spec.Template.Labels).NotTo(HaveKey("component"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(currentLabels))
+		})
+
+		// Test case for the ordered teardown on deletion
+		It("should tear down the workloads in order before releasing the finalizer", func() {
+			// Setup
+			ctx := context.Background()
+			resourceName := "test-resource"
+			typeNamespacedName := types.NamespacedName{Name: resourceName, Namespace: "default"} // Modify namespace as needed
+			redisKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-redis", resourceName)}
+			hookKey := client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("%s-pre-delete", resourceName)}
+
+			// Enable Redis and a pre-delete hook
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			myAppResource.Spec.ReplicaCount = 2
+			myAppResource.Spec.Image = myapigroupv1beta1.ImageSpec{Repository: "ghcr.io/stefanprodan/podinfo", Tag: "6.5.4"}
+			myAppResource.Spec.Redis.Enabled = true
+			myAppResource.Spec.PreDeleteHook = &myapigroupv1beta1.PreDeleteHookSpec{Command: []string{"sh", "-c", "echo bye"}}
+			Expect(k8sClient.Update(ctx, myAppResource)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(myAppResource.Finalizers).To(ContainElement(myAppResourceFinalizer))
+
+			// Delete the resource and check that the app is scaled down first
+			Expect(k8sClient.Delete(ctx, myAppResource)).To(Succeed())
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, deployment)).To(Succeed())
+			Expect(*deployment.Spec.Replicas).To(BeZero())
+			Expect(k8sClient.Get(ctx, redisKey, &appsv1.StatefulSet{})).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			terminating := meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionTerminating)
+			Expect(terminating).NotTo(BeNil())
+			Expect(terminating.Reason).To(Equal(reasonScalingDownApp))
+
+			// Envtest has no Deployment controller, so mark the scale-down as observed
+			deployment.Status.ObservedGeneration = deployment.Generation
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+
+			// Redis is scaled down, then removed
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			redisStatefulSet := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, redisKey, redisStatefulSet)).To(Succeed())
+			Expect(*redisStatefulSet.Spec.Replicas).To(BeZero())
+			redisStatefulSet.Status.ObservedGeneration = redisStatefulSet.Generation
+			Expect(k8sClient.Status().Update(ctx, redisStatefulSet)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, redisKey, &appsv1.StatefulSet{}))).To(BeTrue())
+
+			// The hook runs last and holds the finalizer until it completes
+			job := &batchv1.Job{}
+			Expect(k8sClient.Get(ctx, hookKey, job)).To(Succeed())
+			Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("ghcr.io/stefanprodan/podinfo:6.5.4"))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, myAppResource)).To(Succeed())
+			Expect(meta.FindStatusCondition(myAppResource.Status.Conditions, myapigroupv1beta1.ConditionTerminating).Reason).To(Equal(reasonRunningPreDeleteHook))
+
+			now := metav1.Now()
+			job.Status.StartTime = &now
+			job.Status.CompletionTime = &now
+			job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+			Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+			_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, myAppResource))).To(BeTrue())
+		})
+
+		// Test case for the watches on owned objects
+		It("should only reconcile for changes to owned objects that need it", func() {
+			updated := func(oldObj, newObj client.Object) bool {
+				return ownedObjectPredicate().Update(event.UpdateEvent{ObjectOld: oldObj, ObjectNew: newObj})
+			}
+
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Generation: 1}}
+			deployment.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue}}
+
+			// A resync or a status heartbeat is left out
+			heartbeat := deployment.DeepCopy()
+			heartbeat.ResourceVersion = "2"
+			heartbeat.Status.Conditions[0].LastUpdateTime = metav1.Now()
+			Expect(updated(deployment, heartbeat)).To(BeFalse())
+
+			// An edited spec, a lost pod or removed labels pass
+			edited := deployment.DeepCopy()
+			edited.Generation = 2
+			Expect(updated(deployment, edited)).To(BeTrue())
+			podLost := deployment.DeepCopy()
+			podLost.Status.ReadyReplicas = 1
+			Expect(updated(podLost, deployment)).To(BeTrue())
+			relabelled := deployment.DeepCopy()
+			relabelled.Labels = map[string]string{"app": "other"}
+			Expect(updated(deployment, relabelled)).To(BeTrue())
+
+			// A rollout that exceeds its progress deadline passes, as only its condition changes
+			progressing := deployment.DeepCopy()
+			progressing.Status.Conditions = append(progressing.Status.Conditions, appsv1.DeploymentCondition{
+				Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "ReplicaSetUpdated",
+			})
+			stuck := progressing.DeepCopy()
+			stuck.Status.Conditions[1].Status = corev1.ConditionFalse
+			stuck.Status.Conditions[1].Reason = "ProgressDeadlineExceeded"
+			Expect(updated(progressing, stuck)).To(BeTrue())
+
+			// Services have no generation, so their spec is compared
+			service := &corev1.Service{Spec: corev1.ServiceSpec{Selector: map[string]string{"app": "app"}}}
+			retargeted := service.DeepCopy()
+			retargeted.Spec.Selector = map[string]string{"app": "other"}
+			Expect(updated(service, retargeted)).To(BeTrue())
+			balanced := service.DeepCopy()
+			balanced.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+			Expect(updated(service, balanced)).To(BeFalse())
+
+			// Pods are owned by ReplicaSets and StatefulSets, so they are mapped back by their labels
+			instance := &myapigroupv1beta1.MyAppResource{ObjectMeta: metav1.ObjectMeta{Name: "test-resource", Namespace: "default"}}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "test-resource-redis-0", Namespace: "default", Labels: componentLabels(instance, componentRedis)}}
+			Expect(instanceRequest(ctx, pod)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(instance)}))
+			pod.Labels = map[string]string{"app": "test-resource"}
+			Expect(instanceRequest(ctx, pod)).To(BeEmpty())
+
+			// Only the Secrets and Pods labelled as managed by the controller are cached
+			for obj, byObject := range CacheByObject() {
+				Expect(obj).To(Or(BeAssignableToTypeOf(&corev1.Secret{}), BeAssignableToTypeOf(&corev1.Pod{})))
+				Expect(byObject.Label.Matches(labels.Set(componentLabels(myAppResource, componentRedis)))).To(BeTrue())
+				Expect(byObject.Label.Matches(labels.Set{"app": "test-resource"})).To(BeFalse())
+			}
+		})
+	})
+})
+
+// recordedEvents returns the events recorded so far and clears them.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	return events
+}
+
+// fakeSentinel reports a fixed primary in place of a running Sentinel.
+type fakeSentinel struct {
+	host string
+	err  error
+}
+
+func (s *fakeSentinel) PrimaryAddress(_ context.Context, _, _, _ string) (string, error) {
+	return s.host, s.err
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// replicaCounts is the part of the status of a workload the MyAppResource
+// status and the rollouts are computed from.
+type replicaCounts struct {
+	observedGeneration int64
+	replicas           int32
+	updatedReplicas    int32
+	readyReplicas      int32
+	availableReplicas  int32
+}
+
+// deploymentStatus is the part of the status of a Deployment the MyAppResource
+// status is computed from. A rollout that exceeds its progress deadline only
+// shows in the Progressing condition, so its status and reason are compared
+// too, while its timestamps are not.
+type deploymentStatus struct {
+	replicaCounts
+	progressingStatus corev1.ConditionStatus
+	progressingReason string
+}
+
+// ownedObjectPredicate passes the events of owned objects the reconciler acts
+// on. Creations and deletions always pass, while updates only pass when
+// ownedObjectChanged reports a change, which keeps out resyncs and status
+// heartbeats such as condition timestamps.
+func ownedObjectPredicate() predicate.Funcs {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return ownedObjectChanged(e.ObjectOld, e.ObjectNew)
+		},
+	}
+}
+
+// ownedObjectChanged reports whether an owned object changed in a way that
+// can need reconciling: its spec, labels, annotations or owners were edited,
+// it is being deleted, or the part of its status that is read changed.
+func ownedObjectChanged(oldObj, newObj client.Object) bool {
+	if oldObj.GetGeneration() != newObj.GetGeneration() ||
+		!oldObj.GetDeletionTimestamp().Equal(newObj.GetDeletionTimestamp()) ||
+		!equality.Semantic.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) ||
+		!equality.Semantic.DeepEqual(oldObj.GetAnnotations(), newObj.GetAnnotations()) ||
+		!equality.Semantic.DeepEqual(oldObj.GetOwnerReferences(), newObj.GetOwnerReferences()) {
+		return true
+	}
+
+	// Services and Secrets have no generation, so their content is compared
+	switch oldObj := oldObj.(type) {
+	case *corev1.Service:
+		newObj, ok := newObj.(*corev1.Service)
+		return !ok || !equality.Semantic.DeepEqual(oldObj.Spec, newObj.Spec)
+	case *corev1.Secret:
+		newObj, ok := newObj.(*corev1.Secret)
+		return !ok || oldObj.Type != newObj.Type || !equality.Semantic.DeepEqual(oldObj.Data, newObj.Data)
+	}
+	return !reflect.DeepEqual(observedStatus(oldObj), observedStatus(newObj))
+}
+
+// observedStatus returns the part of the status of an owned object the
+// reconciler reads, or nil for objects whose status it does not read.
+func observedStatus(obj client.Object) any {
+	switch obj := obj.(type) {
+	case *appsv1.Deployment:
+		status := obj.Status
+		observed := deploymentStatus{
+			replicaCounts: replicaCounts{
+				observedGeneration: status.ObservedGeneration,
+				replicas:           status.Replicas,
+				updatedReplicas:    status.UpdatedReplicas,
+				readyReplicas:      status.ReadyReplicas,
+				availableReplicas:  status.AvailableReplicas,
+			},
+		}
+		for _, condition := range status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing {
+				observed.progressingStatus = condition.Status
+				observed.progressingReason = condition.Reason
+			}
+		}
+		return observed
+	case *appsv1.StatefulSet:
+		status := obj.Status
+		return replicaCounts{
+			observedGeneration: status.ObservedGeneration,
+			replicas:           status.Replicas,
+			updatedReplicas:    status.UpdatedReplicas,
+			readyReplicas:      status.ReadyReplicas,
+			availableReplicas:  status.AvailableReplicas,
+		}
+	case *appsv1.ReplicaSet:
+		status := obj.Status
+		return replicaCounts{
+			observedGeneration: status.ObservedGeneration,
+			replicas:           status.Replicas,
+			readyReplicas:      status.ReadyReplicas,
+			availableReplicas:  status.AvailableReplicas,
+		}
+	case *batchv1.Job:
+		finished := map[batchv1.JobConditionType]corev1.ConditionStatus{}
+		for _, condition := range obj.Status.Conditions {
+			finished[condition.Type] = condition.Status
+		}
+		return finished
+	case *networkingv1.Ingress:
+		return obj.Status.LoadBalancer
+	}
+	return nil
+}
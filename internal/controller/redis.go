@@ -0,0 +1,573 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+const (
+	// redisContainerName is the name of the Redis container in the Redis pod template.
+	redisContainerName = "redis"
+	// redisPort is the port Redis listens on.
+	redisPort = 6379
+	// redisDataVolume is the name of the volume mounted at redisDataPath.
+	redisDataVolume = "data"
+	// redisDataPath is the directory Redis writes its AOF and RDB files to.
+	redisDataPath = "/data"
+)
+
+// redisName returns the name of the Redis workload of a MyAppResource.
+func redisName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-redis", myAppResource.Name)
+}
+
+// redisServiceName returns the name of the ClusterIP Service the app reaches Redis through.
+func redisServiceName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return redisName(myAppResource)
+}
+
+// redisEndpoint returns the in-cluster address of the Redis Service.
+func redisEndpoint(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s.%s.svc:%d", redisServiceName(myAppResource), myAppResource.Namespace, redisPort)
+}
+
+// redisHeadlessServiceName returns the name of the headless Service governing
+// the Redis StatefulSet.
+func redisHeadlessServiceName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-redis-headless", myAppResource.Name)
+}
+
+// redisReplicas returns the desired number of Redis replicas. The spec is
+// defaulted before it is reconciled, so the count is set whenever Redis is enabled.
+func redisReplicas(myAppResource *myapigroupv1beta1.MyAppResource) int32 {
+	if !myAppResource.Spec.Redis.Enabled || myAppResource.Spec.Redis.ReplicaCount == nil {
+		return 0
+	}
+	return *myAppResource.Spec.Redis.ReplicaCount
+}
+
+// redisSelectorLabels returns the labels the Redis StatefulSet selects its pods by.
+func redisSelectorLabels(myAppResource *myapigroupv1beta1.MyAppResource) map[string]string {
+	return selectorLabels(myAppResource, componentRedis)
+}
+
+// redisPodSelector returns the labels the Redis Services select the Redis pods
+// by, which stay those of the StatefulSet while it moves to a new selector.
+func (r *MyAppResourceReconciler) redisPodSelector(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (map[string]string, error) {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	return r.podSelector(ctx, myAppResource, statefulSet, redisSelectorLabels(myAppResource))
+}
+
+// redisArgs renders the redis-server arguments for the persistence settings.
+// Without persistence both AOF and RDB snapshots are turned off. The password
+// is expanded from the environment by the kubelet so it stays out of the spec.
+func redisArgs(persistence *myapigroupv1beta1.RedisPersistenceSpec) []string {
+	password := fmt.Sprintf("$(%s)", redisPasswordEnv)
+	args := []string{
+		"--dir", redisDataPath,
+		"--requirepass", password,
+		"--masterauth", password,
+	}
+	if persistence == nil {
+		return append(args, "--appendonly", "no", "--save", "")
+	}
+	appendOnly := "no"
+	if persistence.AppendOnly != nil && *persistence.AppendOnly {
+		appendOnly = "yes"
+	}
+	return append(args,
+		"--appendonly", appendOnly,
+		"--appendfsync", "everysec",
+		"--save", persistence.Save,
+	)
+}
+
+// reconcileRedis applies the Redis StatefulSet, its Services, its
+// auth Secret and, in sentinel mode, the Sentinels, and migrates Redis
+// instances created as a Deployment by
+// earlier versions of the controller. It reports whether the StatefulSet is
+// being replaced or relabelled, or the migration is still waiting for it to
+// become ready.
+func (r *MyAppResourceReconciler) reconcileRedis(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (bool, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	authChecksum, err := r.reconcileRedisAuthSecret(ctx, myAppResource)
+	if err != nil {
+		log.Error(err, "Failed to reconcile Redis auth secret")
+		return false, err
+	}
+
+	if err := r.reconcileRedisHeadlessService(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile Redis headless service")
+		return false, err
+	}
+
+	if err := r.reconcileRedisService(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile Redis service")
+		return false, err
+	}
+
+	statefulSet, relabelling, err := r.reconcileRedisStatefulSet(ctx, myAppResource, desired, authChecksum)
+	if err != nil {
+		log.Error(err, "Failed to reconcile Redis statefulset")
+		return false, err
+	}
+	if statefulSet == nil {
+		return true, nil
+	}
+
+	if redisSentinelMode(myAppResource) {
+		if err := r.reconcileRedisSentinel(ctx, myAppResource, desired, authChecksum); err != nil {
+			log.Error(err, "Failed to reconcile Redis sentinel")
+			return false, err
+		}
+		if err := r.reconcileRedisPrimary(ctx, myAppResource); err != nil {
+			log.Error(err, "Failed to reconcile Redis primary")
+			return false, err
+		}
+	} else {
+		// Sentinel is no longer needed after switching back to standalone mode
+		if _, err := r.deleteControlledObjects(ctx, myAppResource, redisSentinelObjects(myAppResource)); err != nil {
+			log.Error(err, "Failed to remove Redis sentinel")
+			return false, err
+		}
+	}
+
+	if err := r.reconcileRedisDisruptionBudgets(ctx, myAppResource); err != nil {
+		log.Error(err, "Failed to reconcile Redis disruption budgets")
+		return false, err
+	}
+
+	pending, err := r.migrateRedisDeployment(ctx, myAppResource, statefulSet)
+	if err != nil {
+		log.Error(err, "Failed to migrate Redis deployment")
+		return false, err
+	}
+	return pending || relabelling, nil
+}
+
+// reconcileRedisHeadlessService applies the headless Service that
+// gives each Redis pod a stable DNS name.
+func (r *MyAppResourceReconciler) reconcileRedisHeadlessService(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisHeadlessServiceName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	selector, err := r.redisPodSelector(ctx, myAppResource)
+	if err != nil {
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, service, func() error {
+		service.Labels = componentLabels(myAppResource, componentRedis)
+		service.Spec.ClusterIP = corev1.ClusterIPNone
+		service.Spec.Selector = selector
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "redis",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       redisPort,
+				TargetPort: intstr.FromInt32(redisPort),
+			},
+		}
+		// Replicas are addressable while they start so they can find each other
+		service.Spec.PublishNotReadyAddresses = true
+		return ctrl.SetControllerReference(myAppResource, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, service, op)
+	return nil
+}
+
+// reconcileRedisService applies the ClusterIP Service the app
+// connects to Redis through. In sentinel mode it follows the primary.
+func (r *MyAppResourceReconciler) reconcileRedisService(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisServiceName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	selector, err := r.redisPodSelector(ctx, myAppResource)
+	if err != nil {
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, service, func() error {
+		service.Labels = componentLabels(myAppResource, componentRedis)
+		// The cluster IP is allocated by the API server and left untouched
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		service.Spec.Selector = redisServiceSelector(myAppResource, selector)
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "redis",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       redisPort,
+				TargetPort: intstr.FromString("redis"),
+			},
+		}
+		return ctrl.SetControllerReference(myAppResource, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, service, op)
+	return nil
+}
+
+// reconcileRedisStatefulSet applies the Redis StatefulSet and
+// returns it. The selector, service name and volume claim templates cannot be
+// changed in place, so a StatefulSet that no longer matches them is deleted
+// and created again on a later pass, in which case nil is returned. For a new
+// selector the pods are relabelled first; the returned bool reports that the
+// StatefulSet is being replaced or relabelled.
+func (r *MyAppResourceReconciler) reconcileRedisStatefulSet(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, authChecksum string) (*appsv1.StatefulSet, bool, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	current := &appsv1.StatefulSet{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(statefulSet), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, false, err
+	}
+	var relabelling bool
+	if err == nil {
+		if !current.DeletionTimestamp.IsZero() {
+			log.Info("Waiting for the Redis statefulset to be deleted before creating it again", "Namespace", current.Namespace, "Name", current.Name)
+			return nil, true, nil
+		}
+		switch field := redisStatefulSetImmutableDrift(myAppResource, desired, current); field {
+		case "":
+		case "selector":
+			// The pods are relabelled before the StatefulSet is replaced, so
+			// that the new one adopts them
+			migration, err := r.migrateSelector(ctx, myAppResource, current, redisSelectorLabels(myAppResource), statefulSetReady(current))
+			if err != nil {
+				return nil, false, err
+			}
+			if migration == selectorReplacing {
+				return nil, true, nil
+			}
+			relabelling = true
+		default:
+			// The pods keep serving and are adopted and rolled by the new StatefulSet
+			log.Info("Recreating Redis statefulset to change an immutable field", "Namespace", current.Namespace, "Name", current.Name, "field", field)
+			if err := r.Delete(ctx, current, client.PropagationPolicy(metav1.DeletePropagationOrphan)); err != nil && !errors.IsNotFound(err) {
+				return nil, false, err
+			}
+			r.recordEvent(myAppResource, corev1.EventTypeNormal, eventRecreating,
+				fmt.Sprintf("Recreating Redis StatefulSet %s to change its %s; its pods are kept", current.Name, field))
+			return nil, true, nil
+		}
+	}
+
+	op, err := r.apply(ctx, myAppResource, statefulSet, func() error {
+		return r.mutateRedisStatefulSet(myAppResource, desired, statefulSet, current, authChecksum)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	recordScaledPods(myAppResource, componentRedis, statefulSetReplicas(current), statefulSetReplicas(statefulSet))
+	if op != controllerutil.OperationResultNone {
+		log.Info("Reconciled Redis statefulset", "Namespace", statefulSet.Namespace, "Name", statefulSet.Name, "operation", op)
+	}
+	r.recordCreated(myAppResource, statefulSet, op)
+	return statefulSet, relabelling, nil
+}
+
+// mutateRedisStatefulSet writes the fields of the Redis StatefulSet owned by
+// the controller, given the StatefulSet currently stored, which is empty while
+// there is none. A changed password checksum rolls the pods one at a time.
+func (r *MyAppResourceReconciler) mutateRedisStatefulSet(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, statefulSet, current *appsv1.StatefulSet, authChecksum string) error {
+	redis := myAppResource.Spec.Redis
+	labels := redisSelectorLabels(myAppResource)
+	replicas := redisReplicas(myAppResource)
+
+	statefulSet.Labels = componentLabels(myAppResource, componentRedis)
+	// The selector, service name and claim templates are immutable, so the
+	// stored ones are applied as they are. They only differ from the spec
+	// while the StatefulSet is being replaced.
+	statefulSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+	statefulSet.Spec.ServiceName = redisHeadlessServiceName(myAppResource)
+	statefulSet.Spec.VolumeClaimTemplates = redisVolumeClaimTemplates(myAppResource, desired)
+	if current.ResourceVersion != "" {
+		statefulSet.Spec.Selector = current.Spec.Selector
+		statefulSet.Spec.ServiceName = current.Spec.ServiceName
+		statefulSet.Spec.VolumeClaimTemplates = current.Spec.VolumeClaimTemplates
+	}
+	statefulSet.Spec.Replicas = &replicas
+
+	template := &statefulSet.Spec.Template
+	template.Labels = componentLabels(myAppResource, componentRedis)
+	// A stale selector still needs its labels on the pods
+	if statefulSet.Spec.Selector != nil {
+		template.Labels = mergeStringMap(template.Labels, statefulSet.Spec.Selector.MatchLabels)
+	}
+	template.Annotations = map[string]string{redisAuthChecksumAnnotation: authChecksum}
+
+	template.Spec.Containers = []corev1.Container{{Name: redisContainerName}}
+	container := &template.Spec.Containers[0]
+	container.Image = containerImageName(redis.Image)
+	if redis.Image.PullPolicy != "" {
+		container.ImagePullPolicy = redis.Image.PullPolicy
+	}
+	container.Command, container.Env = redisContainerCommand(myAppResource)
+	container.Args = redisArgs(redis.Persistence)
+	container.Ports = []corev1.ContainerPort{
+		{Name: "redis", ContainerPort: redisPort, Protocol: corev1.ProtocolTCP},
+	}
+	container.Resources = desired.redisResources
+	container.LivenessProbe = containerProbe(redis.Probes.Liveness)
+	container.ReadinessProbe = containerProbe(redis.Probes.Readiness)
+	container.StartupProbe = containerProbe(redis.Probes.Startup)
+	container.VolumeMounts = []corev1.VolumeMount{
+		{Name: redisDataVolume, MountPath: redisDataPath},
+	}
+
+	// With persistence the data volume comes from the claim templates,
+	// otherwise it is an emptyDir
+	if redis.Persistence == nil {
+		template.Spec.Volumes = []corev1.Volume{{
+			Name:         redisDataVolume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		}}
+	}
+
+	// Set MyAppResource instance as the owner and controller
+	return ctrl.SetControllerReference(myAppResource, statefulSet, r.Scheme)
+}
+
+// redisVolumeClaimTemplates renders the claim templates for the persistence
+// settings. Each replica gets its own PersistentVolumeClaim; the claims are
+// kept when the StatefulSet is deleted so the data survives a re-creation.
+func redisVolumeClaimTemplates(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) []corev1.PersistentVolumeClaim {
+	persistence := myAppResource.Spec.Redis.Persistence
+	if persistence == nil {
+		return nil
+	}
+	return []corev1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   redisDataVolume,
+				Labels: redisSelectorLabels(myAppResource),
+			},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      []corev1.PersistentVolumeAccessMode{persistence.AccessMode},
+				StorageClassName: persistence.StorageClassName,
+				Resources: corev1.VolumeResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceStorage: *desired.redisStorage,
+					},
+				},
+			},
+		},
+	}
+}
+
+// redisStatefulSetImmutableDrift returns the immutable field of the Redis
+// StatefulSet that no longer matches the spec, or an empty string.
+func redisStatefulSetImmutableDrift(myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, statefulSet *appsv1.StatefulSet) string {
+	selector := statefulSet.Spec.Selector
+	if selector == nil || staleSelector(selector, redisSelectorLabels(myAppResource)) {
+		return "selector"
+	}
+	if statefulSet.Spec.ServiceName != redisHeadlessServiceName(myAppResource) {
+		return "serviceName"
+	}
+
+	// Only the fields set by the controller are compared, as the API server
+	// fills in defaults such as the volume mode
+	actual := statefulSet.Spec.VolumeClaimTemplates
+	templates := redisVolumeClaimTemplates(myAppResource, desired)
+	if len(actual) != len(templates) {
+		return "volumeClaimTemplates"
+	}
+	for i := range templates {
+		if actual[i].Name != templates[i].Name ||
+			!equality.Semantic.DeepEqual(actual[i].Spec.AccessModes, templates[i].Spec.AccessModes) ||
+			!ptr.Equal(actual[i].Spec.StorageClassName, templates[i].Spec.StorageClassName) ||
+			actual[i].Spec.Resources.Requests.Storage().Cmp(*templates[i].Spec.Resources.Requests.Storage()) != 0 {
+			return "volumeClaimTemplates"
+		}
+	}
+	return ""
+}
+
+// redisObjects returns the objects making up Redis, including the Redis
+// Deployment of earlier controller versions and the Sentinels.
+func redisObjects(myAppResource *myapigroupv1beta1.MyAppResource) []client.Object {
+	namespace := myAppResource.Namespace
+	return append([]client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisName(myAppResource)}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisName(myAppResource)}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisServiceName(myAppResource)}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisHeadlessServiceName(myAppResource)}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisAuthSecretName(myAppResource)}},
+		&policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisName(myAppResource)}},
+	}, redisSentinelObjects(myAppResource)...)
+}
+
+// redisSentinelObjects returns the objects making up the Sentinels.
+func redisSentinelObjects(myAppResource *myapigroupv1beta1.MyAppResource) []client.Object {
+	namespace := myAppResource.Namespace
+	return []client.Object{
+		&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisSentinelName(myAppResource)}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisSentinelName(myAppResource)}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisSentinelHeadlessServiceName(myAppResource)}},
+		&policyv1.PodDisruptionBudget{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: redisSentinelName(myAppResource)}},
+	}
+}
+
+// removeRedis deletes the Redis objects of a MyAppResource whose Redis has
+// been disabled, and returns the ones it deleted as <kind>/<name>. The
+// PersistentVolumeClaims are kept so the data is still there when Redis is
+// enabled again.
+func (r *MyAppResourceReconciler) removeRedis(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) ([]string, error) {
+	return r.deleteControlledObjects(ctx, myAppResource, redisObjects(myAppResource))
+}
+
+// deleteControlledObjects deletes the objects controlled by the MyAppResource
+// and returns the ones it deleted as <kind>/<name>. Objects that do not exist,
+// are already being deleted or belong to someone else are skipped.
+func (r *MyAppResourceReconciler) deleteControlledObjects(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, objects []client.Object) ([]string, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	var removed []string
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+		if err != nil {
+			return removed, err
+		}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return removed, err
+		}
+		if !metav1.IsControlledBy(obj, myAppResource) || !obj.GetDeletionTimestamp().IsZero() {
+			continue
+		}
+
+		log.Info("Deleting object that is no longer needed", "Kind", gvk.Kind, "Namespace", obj.GetNamespace(), "Name", obj.GetName())
+		if err := r.Delete(ctx, obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			return removed, err
+		}
+		removed = append(removed, fmt.Sprintf("%s/%s", gvk.Kind, obj.GetName()))
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventDeleted, fmt.Sprintf("Deleted %s %s, which is no longer needed", gvk.Kind, obj.GetName()))
+	}
+	return removed, nil
+}
+
+// mergeStringMap sets the entries of src in dst, allocating dst when needed,
+// and returns it. Entries added by others are kept.
+func mergeStringMap(dst, src map[string]string) map[string]string {
+	if dst == nil {
+		dst = make(map[string]string, len(src))
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// migrateRedisDeployment removes the Redis Deployment created by earlier
+// versions of the controller once the StatefulSet replacing it is ready. It
+// reports whether the Deployment is still waiting to be removed.
+func (r *MyAppResourceReconciler) migrateRedisDeployment(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, statefulSet *appsv1.StatefulSet) (bool, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisName(myAppResource)}, deployment)
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !metav1.IsControlledBy(deployment, myAppResource) {
+		// Not ours to remove
+		return false, nil
+	}
+
+	if !statefulSetReady(statefulSet) {
+		log.Info("Waiting for the Redis statefulset to become ready before removing the Redis deployment")
+		return true, nil
+	}
+
+	log.Info("Deleting Redis deployment replaced by the statefulset", "Namespace", deployment.Namespace, "Name", deployment.Name)
+	if err := r.Delete(ctx, deployment, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return true, err
+	}
+	r.recordEvent(myAppResource, corev1.EventTypeNormal, eventDeleted, fmt.Sprintf("Deleted Redis Deployment %s, replaced by StatefulSet %s", deployment.Name, statefulSet.Name))
+	return false, nil
+}
+
+// statefulSetReplicas returns the desired replicas of a StatefulSet, which
+// are zero while it does not exist.
+func statefulSetReplicas(statefulSet *appsv1.StatefulSet) int32 {
+	if statefulSet.ResourceVersion == "" {
+		return 0
+	}
+	if statefulSet.Spec.Replicas == nil {
+		return 1
+	}
+	return *statefulSet.Spec.Replicas
+}
+
+// statefulSetReady reports whether the StatefulSet controller has observed the
+// latest spec and all desired replicas are updated and ready.
+func statefulSetReady(statefulSet *appsv1.StatefulSet) bool {
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false
+	}
+	desired := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		desired = *statefulSet.Spec.Replicas
+	}
+	return statefulSet.Status.UpdatedReplicas >= desired && statefulSet.Status.ReadyReplicas >= desired
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+const (
+	// redisPasswordKey is the key of the password in the Redis auth Secret.
+	redisPasswordKey = "password"
+	// redisPasswordEnv is the variable the Redis container reads its password from.
+	redisPasswordEnv = "REDIS_PASSWORD"
+	// redisPasswordLength is the number of random bytes in a generated password.
+	redisPasswordLength = 32
+
+	// redisAuthChecksumAnnotation is set on the Redis and app pod templates to
+	// the checksum of the password they run with, so that a new password
+	// rolls both workloads.
+	redisAuthChecksumAnnotation = "my.api.group.rama.angi.platform/redis-auth-checksum"
+	// redisRotationRequestAnnotation records on the Secret the value of the
+	// RotateRedisPasswordAnnotation that was last acted on.
+	redisRotationRequestAnnotation = "my.api.group.rama.angi.platform/rotation-request"
+	// redisRotatedAtAnnotation records on the Secret when the password was last rotated.
+	redisRotatedAtAnnotation = "my.api.group.rama.angi.platform/rotated-at"
+)
+
+// redisAuthSecretName returns the name of the Secret holding the Redis password.
+func redisAuthSecretName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-redis-auth", myAppResource.Name)
+}
+
+// redisPasswordEnvSource reads the Redis password from the auth Secret.
+func redisPasswordEnvSource(myAppResource *myapigroupv1beta1.MyAppResource) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: redisAuthSecretName(myAppResource)},
+			Key:                  redisPasswordKey,
+		},
+	}
+}
+
+// generateRedisPassword returns a random URL-safe password.
+func generateRedisPassword() ([]byte, error) {
+	buf := make([]byte, redisPasswordLength)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	password := make([]byte, base64.RawURLEncoding.EncodedLen(len(buf)))
+	base64.RawURLEncoding.Encode(password, buf)
+	return password, nil
+}
+
+// passwordChecksum returns the checksum written to the pod templates for a
+// password. It changes with the password without revealing it.
+func passwordChecksum(password []byte) string {
+	sum := sha256.Sum256(password)
+	return hex.EncodeToString(sum[:])
+}
+
+// reconcileRedisAuthSecret creates the Secret holding the Redis password and
+// rotates the password when the RotateRedisPasswordAnnotation has a value that
+// was not acted on before. It returns the checksum of the current password.
+func (r *MyAppResourceReconciler) reconcileRedisAuthSecret(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (string, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+	request := myAppResource.Annotations[myapigroupv1beta1.RotateRedisPasswordAnnotation]
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisAuthSecretName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	current := &corev1.Secret{}
+	err := r.getObject(ctx, client.ObjectKeyFromObject(secret), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return "", err
+	}
+	found := err == nil
+
+	// The rotation bookkeeping is kept from the stored Secret
+	annotations := map[string]string{}
+	for _, key := range []string{redisRotationRequestAnnotation, redisRotatedAtAnnotation} {
+		if value, ok := current.Annotations[key]; ok {
+			annotations[key] = value
+		}
+	}
+	password := current.Data[redisPasswordKey]
+	rotate := found && request != "" && request != current.Annotations[redisRotationRequestAnnotation]
+	switch {
+	case !found:
+		// A rotation requested before the Secret existed is already satisfied
+		annotations[redisRotationRequestAnnotation] = request
+		log.Info("Creating Redis auth secret", "Namespace", secret.Namespace, "Name", secret.Name)
+	case rotate:
+		annotations[redisRotationRequestAnnotation] = request
+		annotations[redisRotatedAtAnnotation] = time.Now().UTC().Format(time.RFC3339)
+		log.Info("Rotating Redis password", "Namespace", secret.Namespace, "Name", secret.Name)
+	case len(password) == 0:
+		log.Info("Regenerating missing Redis password", "Namespace", secret.Namespace, "Name", secret.Name)
+	}
+	if !found || rotate || len(password) == 0 {
+		if password, err = generateRedisPassword(); err != nil {
+			return "", err
+		}
+	}
+
+	op, err := r.apply(ctx, myAppResource, secret, func() error {
+		secret.Labels = componentLabels(myAppResource, componentRedis)
+		secret.Annotations = annotations
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{redisPasswordKey: password}
+		return ctrl.SetControllerReference(myAppResource, secret, r.Scheme)
+	})
+	if err != nil {
+		return "", err
+	}
+	r.recordCreated(myAppResource, secret, op)
+	if rotate {
+		r.recordEvent(myAppResource, corev1.EventTypeNormal, eventPasswordRotated, fmt.Sprintf("Rotated the Redis password in Secret %s", secret.Name))
+	}
+	return passwordChecksum(password), nil
+}
+
+// appRedisAuth returns the checksum of the current Redis password and whether
+// Redis has rolled out with it. The app is only restarted for a new password
+// once Redis accepts it.
+func (r *MyAppResourceReconciler) appRedisAuth(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) (string, bool, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisAuthSecretName(myAppResource)}, secret)
+	if errors.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	checksum := passwordChecksum(secret.Data[redisPasswordKey])
+
+	statefulSet := &appsv1.StatefulSet{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisName(myAppResource)}, statefulSet)
+	if errors.IsNotFound(err) {
+		return checksum, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return checksum, redisAuthRolledOut(statefulSet, checksum), nil
+}
+
+// redisAuthRolledOut reports whether every Redis replica runs with the password
+// of the given checksum, after which the app can be restarted to pick it up.
+func redisAuthRolledOut(statefulSet *appsv1.StatefulSet, checksum string) bool {
+	return statefulSet.Spec.Template.Annotations[redisAuthChecksumAnnotation] == checksum && statefulSetReady(statefulSet)
+}
+
+// redisPasswordRotatedAt returns the rotation time recorded on the auth Secret.
+func redisPasswordRotatedAt(secret *corev1.Secret) *metav1.Time {
+	rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[redisRotatedAtAnnotation])
+	if err != nil {
+		return nil
+	}
+	return &metav1.Time{Time: rotatedAt}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+const (
+	// appRevisionLabel carries the revision of the pod template on the app
+	// pods, so that the Services of a blue/green rollout can select one
+	// version.
+	appRevisionLabel = appRevisionAnnotation
+	// rolloutCheckInterval is how often a rollout is checked while new pods
+	// start or the promoted version rolls out.
+	rolloutCheckInterval = 5 * time.Second
+)
+
+// rolloutHoldsRevision reports whether the app Deployment is kept on its
+// stable revision because a rollout of a new one is in progress or was
+// aborted.
+func rolloutHoldsRevision(myAppResource *myapigroupv1beta1.MyAppResource) bool {
+	rollout := myAppResource.Status.Rollout
+	if rollout == nil {
+		return false
+	}
+	switch rollout.Phase {
+	case myapigroupv1beta1.RolloutPhaseProgressing, myapigroupv1beta1.RolloutPhaseAborted,
+		myapigroupv1beta1.RolloutPhasePreview, myapigroupv1beta1.RolloutPhasePromoted:
+		return true
+	}
+	return false
+}
+
+// rolloutPhaseOfStrategy reports whether a rollout phase belongs to the
+// strategy of the spec, so that a rollout is started over when the strategy
+// is changed while it runs.
+func rolloutPhaseOfStrategy(myAppResource *myapigroupv1beta1.MyAppResource, phase myapigroupv1beta1.RolloutPhase) bool {
+	switch phase {
+	case myapigroupv1beta1.RolloutPhasePromoting:
+		return true
+	case myapigroupv1beta1.RolloutPhaseProgressing, myapigroupv1beta1.RolloutPhaseAborted:
+		return myAppResource.Spec.Rollout.Canary != nil
+	default:
+		return myAppResource.Spec.Rollout.BlueGreen != nil
+	}
+}
+
+// rolloutTotalReplicas returns the replicas the app runs with. The autoscaler
+// sizes the stable version, and a rollout is sized on top of it.
+func rolloutTotalReplicas(myAppResource *myapigroupv1beta1.MyAppResource, deployment *appsv1.Deployment) int32 {
+	if myAppResource.Spec.Autoscaling != nil && deployment.Spec.Replicas != nil {
+		return *deployment.Spec.Replicas
+	}
+	return myAppResource.Spec.ReplicaCount
+}
+
+// setRolloutCondition records the state of a rollout in the condition of the
+// strategy of the spec.
+func setRolloutCondition(myAppResource *myapigroupv1beta1.MyAppResource, status metav1.ConditionStatus, reason, message string) {
+	conditionType := myapigroupv1beta1.ConditionCanary
+	if myAppResource.Spec.Rollout.BlueGreen != nil {
+		conditionType = myapigroupv1beta1.ConditionBlueGreen
+	}
+	meta.SetStatusCondition(&myAppResource.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: myAppResource.Generation,
+	})
+}
+
+// reconcileAppRollout advances a canary or blue/green rollout of a new app
+// revision and records its progress in the status, which tells
+// reconcileAppDeployment whether to hold the Deployment on the stable revision.
+// It returns when the rollout should be checked again, or 0 when none runs or
+// it waits for an approval.
+func (r *MyAppResourceReconciler) reconcileAppRollout(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) (time.Duration, error) {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+	strategy := myAppResource.Spec.Rollout
+
+	var stable string
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	}
+	if err == nil {
+		stable = deployment.Annotations[appRevisionAnnotation]
+	}
+	revision, err := appRevision(myAppResource, desired)
+	if err != nil {
+		return 0, err
+	}
+
+	rollout := myAppResource.Status.Rollout
+	// A new Deployment, or one written before revisions were recorded, has no
+	// stable version to roll out from
+	if (strategy.Canary == nil && strategy.BlueGreen == nil) || stable == "" || stable == revision {
+		promoted := rollout != nil && rollout.Phase == myapigroupv1beta1.RolloutPhasePromoting && stable == revision
+		if promoted && !deploymentRolledOut(deployment) {
+			// The canary or preview pods keep serving until the Deployment
+			// has rolled out the new version
+			rollout.StableRevision = stable
+			return rolloutCheckInterval, nil
+		}
+		if _, err := r.deleteControlledObjects(ctx, myAppResource, rolloutReplicaSets(myAppResource)); err != nil {
+			return 0, err
+		}
+		promotedReason, revertedReason := reasonCanaryPromoted, reasonCanaryReverted
+		if strategy.BlueGreen != nil {
+			promotedReason, revertedReason = reasonBlueGreenPromoted, reasonBlueGreenRolledBack
+		}
+		switch {
+		case strategy.Canary == nil && strategy.BlueGreen == nil:
+			meta.RemoveStatusCondition(&myAppResource.Status.Conditions, myapigroupv1beta1.ConditionCanary)
+			meta.RemoveStatusCondition(&myAppResource.Status.Conditions, myapigroupv1beta1.ConditionBlueGreen)
+		case promoted:
+			log.Info("Promoted rollout", "revision", revision)
+			setRolloutCondition(myAppResource, metav1.ConditionFalse, promotedReason, fmt.Sprintf("Revision %s is promoted", revision))
+		case rollout != nil && stable == revision:
+			setRolloutCondition(myAppResource, metav1.ConditionFalse, revertedReason,
+				fmt.Sprintf("The spec is back at the stable revision %s; revision %s is dropped", stable, rollout.Revision))
+		}
+		myAppResource.Status.Rollout = nil
+		return 0, nil
+	}
+
+	if rollout == nil || rollout.Revision != revision || !rolloutPhaseOfStrategy(myAppResource, rollout.Phase) {
+		phase := myapigroupv1beta1.RolloutPhaseProgressing
+		if strategy.BlueGreen != nil {
+			phase = myapigroupv1beta1.RolloutPhasePreview
+		}
+		log.Info("Starting rollout", "phase", phase, "revision", revision, "stableRevision", stable)
+		// Drop the pods of a rollout with another strategy
+		if _, err := r.deleteControlledObjects(ctx, myAppResource, rolloutReplicaSets(myAppResource)); err != nil {
+			return 0, err
+		}
+		rollout = &myapigroupv1beta1.RolloutStatus{
+			Phase:    phase,
+			Revision: revision,
+		}
+		myAppResource.Status.Rollout = rollout
+	}
+	rollout.StableRevision = stable
+
+	if rollout.Phase == myapigroupv1beta1.RolloutPhasePromoting {
+		// The Deployment is moved to the new revision in this pass
+		reason := reasonCanaryPromoting
+		if strategy.BlueGreen != nil {
+			reason = reasonBlueGreenPromoting
+		}
+		setRolloutCondition(myAppResource, metav1.ConditionTrue, reason, fmt.Sprintf("Rolling out revision %s to all replicas", revision))
+		return rolloutCheckInterval, nil
+	}
+	if strategy.BlueGreen != nil {
+		return r.advanceBlueGreen(ctx, myAppResource, desired, deployment, revision)
+	}
+	return r.advanceCanary(ctx, myAppResource, desired, deployment, revision)
+}
+
+// rolloutReplicaSets returns the ReplicaSets the canary and the preview of a
+// rollout run in.
+func rolloutReplicaSets(myAppResource *myapigroupv1beta1.MyAppResource) []client.Object {
+	var objs []client.Object
+	for _, name := range []string{appCanaryName(myAppResource), appPreviewName(myAppResource)} {
+		objs = append(objs, &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: myAppResource.Namespace},
+		})
+	}
+	return objs
+}
+
+// reconcileRolloutReplicaSet applies the named ReplicaSet running
+// revision with the given selector labels. A ReplicaSet does not replace its
+// pods when its template changes, so a ReplicaSet of another revision or with
+// another selector is deleted instead and nil is returned until it is gone.
+func (r *MyAppResourceReconciler) reconcileRolloutReplicaSet(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, name string, labels map[string]string, revision string, replicas int32) (*appsv1.ReplicaSet, error) {
+	replicaSet := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	current := &appsv1.ReplicaSet{}
+	err := r.Get(ctx, client.ObjectKeyFromObject(replicaSet), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil && (current.Annotations[appRevisionAnnotation] != revision || staleSelector(current.Spec.Selector, labels)) {
+		_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{current})
+		return nil, err
+	}
+
+	op, err := r.apply(ctx, myAppResource, replicaSet, func() error {
+		replicaSet.Labels = mergeStringMap(componentLabels(myAppResource, componentApp), labels)
+		replicaSet.Annotations = map[string]string{appRevisionAnnotation: revision}
+		replicaSet.Spec.Replicas = &replicas
+		// An existing ReplicaSet with another selector has been deleted above,
+		// so the immutable selector always matches
+		replicaSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		template := &replicaSet.Spec.Template
+		mutateAppPodTemplate(myAppResource, desired, template)
+		template.Labels = mergeStringMap(template.Labels, labels)
+		template.Labels[appRevisionLabel] = revision
+		return ctrl.SetControllerReference(myAppResource, replicaSet, r.Scheme)
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.recordCreated(myAppResource, replicaSet, op)
+	return replicaSet, nil
+}
@@ -0,0 +1,407 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+const (
+	// sentinelContainerName is the name of the Sentinel container in the Sentinel pod template.
+	sentinelContainerName = "sentinel"
+	// sentinelPort is the port Sentinel listens on.
+	sentinelPort = 26379
+	// sentinelConfigVolume is the name of the writable volume Sentinel keeps its
+	// configuration in; Sentinel rewrites it as it learns about failovers.
+	sentinelConfigVolume = "config"
+	// sentinelConfigPath is the directory sentinelConfigVolume is mounted at.
+	sentinelConfigPath = "/data"
+	// sentinelMasterName is the name Sentinel monitors the Redis primary under.
+	sentinelMasterName = "primary"
+	// sentinelPollInterval is how often the primary is looked up in sentinel mode.
+	sentinelPollInterval = 10 * time.Second
+
+	// redisRoleLabel is set on each Redis pod in sentinel mode to its current
+	// role, so that the Redis Service only selects the primary.
+	redisRoleLabel   = "redis-role"
+	redisRolePrimary = "primary"
+	redisRoleReplica = "replica"
+)
+
+// redisServerScript starts a Redis pod in sentinel mode as the primary or as a
+// replica of the primary Sentinel reports. The first pod is the primary until
+// the Sentinels are up.
+const redisServerScript = `set -e
+self="${POD_NAME}.${REDIS_DOMAIN}"
+primary="$(redis-cli -h "${SENTINEL_HOST}" -p 26379 --raw sentinel get-master-addr-by-name "${SENTINEL_MASTER}" 2>/dev/null | head -n 1 || true)"
+case "${primary}" in ""|*" "*) primary="${REDIS_DEFAULT_PRIMARY}" ;; esac
+if [ "${primary}" = "${self}" ] || [ "${primary}" = "${POD_IP}" ]; then
+  exec redis-server "$@" --replica-announce-ip "${self}"
+fi
+exec redis-server "$@" --replica-announce-ip "${self}" --replicaof "${primary}" 6379
+`
+
+// sentinelScript writes the Sentinel configuration, monitoring the primary the
+// other Sentinels agree on, and starts Sentinel.
+const sentinelScript = `set -e
+primary="$(redis-cli -h "${SENTINEL_HOST}" -p 26379 --raw sentinel get-master-addr-by-name "${SENTINEL_MASTER}" 2>/dev/null | head -n 1 || true)"
+case "${primary}" in ""|*" "*) primary="${REDIS_DEFAULT_PRIMARY}" ;; esac
+cat > /data/sentinel.conf <<EOF
+port 26379
+dir /data
+sentinel resolve-hostnames yes
+sentinel announce-hostnames yes
+sentinel announce-ip ${POD_NAME}.${SENTINEL_DOMAIN}
+requirepass ${REDIS_PASSWORD}
+sentinel sentinel-pass ${REDIS_PASSWORD}
+sentinel monitor ${SENTINEL_MASTER} ${primary} 6379 ${SENTINEL_QUORUM}
+sentinel auth-pass ${SENTINEL_MASTER} ${REDIS_PASSWORD}
+sentinel down-after-milliseconds ${SENTINEL_MASTER} 5000
+sentinel failover-timeout ${SENTINEL_MASTER} 60000
+sentinel parallel-syncs ${SENTINEL_MASTER} 1
+EOF
+exec redis-server /data/sentinel.conf --sentinel
+`
+
+// SentinelClient looks up the current Redis primary from Sentinel.
+type SentinelClient interface {
+	// PrimaryAddress returns the host of the named primary as reported by the
+	// Sentinel listening on addr.
+	PrimaryAddress(ctx context.Context, addr, password, name string) (string, error)
+}
+
+// redisSentinelMode reports whether Redis runs with Sentinel.
+func redisSentinelMode(myAppResource *myapigroupv1beta1.MyAppResource) bool {
+	return myAppResource.Spec.Redis.Mode == myapigroupv1beta1.RedisModeSentinel
+}
+
+// redisSentinelName returns the name of the Sentinel StatefulSet and of the
+// Service clients find Sentinel through.
+func redisSentinelName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-redis-sentinel", myAppResource.Name)
+}
+
+// redisSentinelHeadlessServiceName returns the name of the headless Service
+// governing the Sentinel StatefulSet.
+func redisSentinelHeadlessServiceName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-redis-sentinel-headless", myAppResource.Name)
+}
+
+// redisSentinelSelectorLabels returns the labels the Sentinel StatefulSet selects its pods by.
+func redisSentinelSelectorLabels(myAppResource *myapigroupv1beta1.MyAppResource) map[string]string {
+	return selectorLabels(myAppResource, componentRedisSentinel)
+}
+
+// redisSentinelReplicas returns the desired number of Sentinels.
+func redisSentinelReplicas(myAppResource *myapigroupv1beta1.MyAppResource) int32 {
+	sentinel := myAppResource.Spec.Redis.Sentinel
+	if sentinel == nil || sentinel.Replicas == nil {
+		return myapigroupv1beta1.DefaultSentinelReplicas
+	}
+	return *sentinel.Replicas
+}
+
+// redisServiceSelector returns the selector of the Service the app connects
+// to Redis through from the labels the Redis pods are selected by. In sentinel
+// mode it only matches the primary.
+func redisServiceSelector(myAppResource *myapigroupv1beta1.MyAppResource, selector map[string]string) map[string]string {
+	if redisSentinelMode(myAppResource) {
+		selector[redisRoleLabel] = redisRolePrimary
+	}
+	return selector
+}
+
+// redisDefaultPrimary returns the address of the first Redis pod, which is
+// the primary until Sentinel reports otherwise.
+func redisDefaultPrimary(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s-0.%s", redisName(myAppResource), serviceDomain(myAppResource, redisHeadlessServiceName(myAppResource)))
+}
+
+// serviceDomain returns the in-cluster DNS name of a Service.
+func serviceDomain(myAppResource *myapigroupv1beta1.MyAppResource, service string) string {
+	return fmt.Sprintf("%s.%s.svc", service, myAppResource.Namespace)
+}
+
+// sentinelEnv returns the variables the Redis and Sentinel start-up scripts
+// read. The password is also passed as REDISCLI_AUTH for redis-cli.
+func sentinelEnv(myAppResource *myapigroupv1beta1.MyAppResource) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: redisPasswordEnv, ValueFrom: redisPasswordEnvSource(myAppResource)},
+		{Name: "REDISCLI_AUTH", ValueFrom: redisPasswordEnvSource(myAppResource)},
+		{Name: "POD_NAME", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "metadata.name"}}},
+		{Name: "POD_IP", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{APIVersion: "v1", FieldPath: "status.podIP"}}},
+		{Name: "SENTINEL_HOST", Value: serviceDomain(myAppResource, redisSentinelName(myAppResource))},
+		{Name: "SENTINEL_MASTER", Value: sentinelMasterName},
+		{Name: "REDIS_DEFAULT_PRIMARY", Value: redisDefaultPrimary(myAppResource)},
+	}
+}
+
+// redisContainerCommand returns the command and environment of the Redis
+// container. Standalone Redis runs the image entrypoint; in sentinel mode a
+// script picks the role of the pod first. The password is always passed as
+// REDISCLI_AUTH for the redis-cli probes.
+func redisContainerCommand(myAppResource *myapigroupv1beta1.MyAppResource) ([]string, []corev1.EnvVar) {
+	if !redisSentinelMode(myAppResource) {
+		return nil, []corev1.EnvVar{
+			{Name: redisPasswordEnv, ValueFrom: redisPasswordEnvSource(myAppResource)},
+			{Name: "REDISCLI_AUTH", ValueFrom: redisPasswordEnvSource(myAppResource)},
+		}
+	}
+	env := append(sentinelEnv(myAppResource), corev1.EnvVar{
+		Name:  "REDIS_DOMAIN",
+		Value: serviceDomain(myAppResource, redisHeadlessServiceName(myAppResource)),
+	})
+	return []string{"sh", "-c", redisServerScript, "redis-server"}, env
+}
+
+// reconcileRedisSentinel applies the Sentinel StatefulSet and its
+// Services. A StatefulSet left with the selector of an earlier controller
+// version is recreated once its pods carry the current labels.
+func (r *MyAppResourceReconciler) reconcileRedisSentinel(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState, authChecksum string) error {
+	labels := redisSentinelSelectorLabels(myAppResource)
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisSentinelName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	selector, err := r.podSelector(ctx, myAppResource, statefulSet.DeepCopy(), labels)
+	if err != nil {
+		return err
+	}
+	ports := []corev1.ServicePort{
+		{
+			Name:       "sentinel",
+			Protocol:   corev1.ProtocolTCP,
+			Port:       sentinelPort,
+			TargetPort: intstr.FromInt32(sentinelPort),
+		},
+	}
+
+	headless := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisSentinelHeadlessServiceName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	op, err := r.apply(ctx, myAppResource, headless, func() error {
+		headless.Labels = componentLabels(myAppResource, componentRedisSentinel)
+		headless.Spec.ClusterIP = corev1.ClusterIPNone
+		headless.Spec.Selector = selector
+		headless.Spec.Ports = ports
+		// Sentinels announce themselves by name while they start
+		headless.Spec.PublishNotReadyAddresses = true
+		return ctrl.SetControllerReference(myAppResource, headless, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, headless, op)
+
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      redisSentinelName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	op, err = r.apply(ctx, myAppResource, service, func() error {
+		service.Labels = componentLabels(myAppResource, componentRedisSentinel)
+		service.Spec.Type = corev1.ServiceTypeClusterIP
+		service.Spec.Selector = selector
+		service.Spec.Ports = ports
+		return ctrl.SetControllerReference(myAppResource, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, service, op)
+
+	current := &appsv1.StatefulSet{}
+	err = r.Get(ctx, client.ObjectKeyFromObject(statefulSet), current)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		migration, err := r.migrateSelector(ctx, myAppResource, current, labels, statefulSetReady(current))
+		if err != nil || migration == selectorReplacing {
+			return err
+		}
+	}
+
+	op, err = r.apply(ctx, myAppResource, statefulSet, func() error {
+		redis := myAppResource.Spec.Redis
+		replicas := redisSentinelReplicas(myAppResource)
+		quorum := replicas/2 + 1
+		if redis.Sentinel != nil && redis.Sentinel.Quorum != nil {
+			quorum = *redis.Sentinel.Quorum
+		}
+
+		statefulSet.Labels = componentLabels(myAppResource, componentRedisSentinel)
+		// The selector, service name and pod management policy are
+		// immutable, so the stored ones are applied as they are
+		statefulSet.Spec.Selector = &metav1.LabelSelector{MatchLabels: labels}
+		statefulSet.Spec.ServiceName = redisSentinelHeadlessServiceName(myAppResource)
+		// Sentinels do not depend on each other to start
+		statefulSet.Spec.PodManagementPolicy = appsv1.ParallelPodManagement
+		if current.ResourceVersion != "" {
+			statefulSet.Spec.Selector = current.Spec.Selector
+			statefulSet.Spec.ServiceName = current.Spec.ServiceName
+			statefulSet.Spec.PodManagementPolicy = current.Spec.PodManagementPolicy
+		}
+		statefulSet.Spec.Replicas = &replicas
+
+		template := &statefulSet.Spec.Template
+		template.Labels = componentLabels(myAppResource, componentRedisSentinel)
+		// A stale selector still needs its labels on the pods
+		if statefulSet.Spec.Selector != nil {
+			template.Labels = mergeStringMap(template.Labels, statefulSet.Spec.Selector.MatchLabels)
+		}
+		template.Annotations = map[string]string{redisAuthChecksumAnnotation: authChecksum}
+
+		template.Spec.Containers = []corev1.Container{{Name: sentinelContainerName}}
+		container := &template.Spec.Containers[0]
+		container.Image = containerImageName(redis.Image)
+		if redis.Image.PullPolicy != "" {
+			container.ImagePullPolicy = redis.Image.PullPolicy
+		}
+		container.Command = []string{"sh", "-c", sentinelScript}
+		container.Env = append(sentinelEnv(myAppResource),
+			corev1.EnvVar{Name: "SENTINEL_DOMAIN", Value: serviceDomain(myAppResource, redisSentinelHeadlessServiceName(myAppResource))},
+			corev1.EnvVar{Name: "SENTINEL_QUORUM", Value: fmt.Sprint(quorum)},
+		)
+		container.Ports = []corev1.ContainerPort{
+			{Name: "sentinel", ContainerPort: sentinelPort, Protocol: corev1.ProtocolTCP},
+		}
+		container.Resources = desired.sentinelResources
+		container.VolumeMounts = []corev1.VolumeMount{
+			{Name: sentinelConfigVolume, MountPath: sentinelConfigPath},
+		}
+		template.Spec.Volumes = []corev1.Volume{
+			{Name: sentinelConfigVolume, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+		}
+
+		return ctrl.SetControllerReference(myAppResource, statefulSet, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, statefulSet, op)
+	recordScaledPods(myAppResource, componentRedisSentinel, statefulSetReplicas(current), statefulSetReplicas(statefulSet))
+	return nil
+}
+
+// reconcileRedisPrimary looks up the current primary from Sentinel, labels the
+// Redis pods with their role so the Redis Service follows the primary, and
+// records the primary and any failover in the status. While Sentinel cannot be
+// reached the last known primary is kept.
+func (r *MyAppResourceReconciler) reconcileRedisPrimary(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	log := ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource))
+
+	selector, err := r.redisPodSelector(ctx, myAppResource)
+	if err != nil {
+		return err
+	}
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(myAppResource.Namespace), client.MatchingLabels(selector)); err != nil {
+		return err
+	}
+
+	status := &myAppResource.Status.Redis
+	primary, err := r.sentinelPrimary(ctx, myAppResource, podList.Items)
+	if err != nil {
+		log.Info("Could not look up the Redis primary from Sentinel", "error", err.Error())
+	}
+	if primary == "" {
+		primary = status.Primary
+	}
+	if primary == "" {
+		primary = fmt.Sprintf("%s-0", redisName(myAppResource))
+	}
+	if status.Primary != "" && status.Primary != primary {
+		log.Info("Redis primary has moved", "from", status.Primary, "to", primary)
+		r.recordEvent(myAppResource, corev1.EventTypeWarning, eventRedisFailover, fmt.Sprintf("Redis primary has moved from %s to %s", status.Primary, primary))
+		status.Failovers++
+	}
+	status.Primary = primary
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		// Only pods of the Redis StatefulSet take part in failover
+		if owner := metav1.GetControllerOf(pod); owner == nil || owner.Kind != "StatefulSet" || !pod.DeletionTimestamp.IsZero() {
+			continue
+		}
+		role := redisRoleReplica
+		if pod.Name == primary {
+			role = redisRolePrimary
+		}
+		if pod.Labels[redisRoleLabel] == role {
+			continue
+		}
+		patch := client.MergeFrom(pod.DeepCopy())
+		pod.Labels = mergeStringMap(pod.Labels, map[string]string{redisRoleLabel: role})
+		if err := r.Patch(ctx, pod, patch); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to label Redis pod with its role", "Namespace", pod.Namespace, "Name", pod.Name)
+			return err
+		}
+	}
+	return nil
+}
+
+// sentinelPrimary asks Sentinel for the current primary and returns the name
+// of its pod, or an empty string when it is not one of the pods.
+func (r *MyAppResourceReconciler) sentinelPrimary(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, pods []corev1.Pod) (string, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisAuthSecretName(myAppResource)}, secret); err != nil {
+		return "", err
+	}
+
+	sentinel := r.Sentinel
+	if sentinel == nil {
+		sentinel = respSentinelClient{}
+	}
+	addr := net.JoinHostPort(serviceDomain(myAppResource, redisSentinelName(myAppResource)), fmt.Sprint(sentinelPort))
+	host, err := sentinel.PrimaryAddress(ctx, addr, string(secret.Data[redisPasswordKey]), sentinelMasterName)
+	if err != nil {
+		return "", err
+	}
+
+	// Sentinel announces the pods by name, but may report an address
+	name := host
+	if net.ParseIP(host) == nil {
+		name, _, _ = strings.Cut(host, ".")
+	}
+	for _, pod := range pods {
+		if pod.Name == name || pod.Status.PodIP == host {
+			return pod.Name, nil
+		}
+	}
+	return "", fmt.Errorf("sentinel reports primary %s, which is not a Redis pod", host)
+}
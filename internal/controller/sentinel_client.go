@@ -0,0 +1,135 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sentinelTimeout bounds a whole lookup against Sentinel.
+const sentinelTimeout = 5 * time.Second
+
+// respSentinelClient is a SentinelClient speaking the Redis protocol (RESP)
+// directly. The controller only needs a couple of commands, which does not
+// warrant a full Redis client library.
+type respSentinelClient struct{}
+
+// PrimaryAddress implements SentinelClient.
+func (respSentinelClient) PrimaryAddress(ctx context.Context, addr, password, name string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sentinelTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return "", err
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	if password != "" {
+		if _, err := respCommand(conn, reader, "AUTH", password); err != nil {
+			return "", fmt.Errorf("failed to authenticate to sentinel: %w", err)
+		}
+	}
+	reply, err := respCommand(conn, reader, "SENTINEL", "GET-MASTER-ADDR-BY-NAME", name)
+	if err != nil {
+		return "", err
+	}
+	hostPort, ok := reply.([]interface{})
+	if !ok || len(hostPort) != 2 {
+		return "", fmt.Errorf("sentinel does not know primary %q", name)
+	}
+	host, ok := hostPort[0].(string)
+	if !ok || host == "" {
+		return "", fmt.Errorf("unexpected sentinel reply %v", reply)
+	}
+	return host, nil
+}
+
+// respCommand sends a command and reads its reply.
+func respCommand(w io.Writer, r *bufio.Reader, args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return nil, err
+	}
+	return readRESP(r)
+}
+
+// readRESP reads one reply. Simple and bulk strings are returned as string,
+// integers as int64, arrays as []interface{} and nulls as nil. Error replies
+// are returned as an error.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("empty reply")
+	}
+
+	switch prefix, rest := line[0], line[1:]; prefix {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, errors.New(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(rest)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply %q", line)
+	}
+}
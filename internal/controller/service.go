@@ -0,0 +1,176 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// appServiceName returns the name of the Service in front of the app, which
+// is also the name of its Ingress.
+func appServiceName(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return myAppResource.Name
+}
+
+// appEndpoint returns the in-cluster address of the app Service.
+func appEndpoint(myAppResource *myapigroupv1beta1.MyAppResource) string {
+	return fmt.Sprintf("%s:%d", serviceDomain(myAppResource, appServiceName(myAppResource)), myAppResource.Spec.Service.Port)
+}
+
+// reconcileAppService applies the Service the app is reached through.
+func (r *MyAppResourceReconciler) reconcileAppService(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, desired *desiredState) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appServiceName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	spec := myAppResource.Spec.Service
+	// The app pods stay selected while the Deployment moves to a new selector
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      myAppResource.Name,
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	pods, err := r.podSelector(ctx, myAppResource, deployment, appSelectorLabels(myAppResource))
+	if err != nil {
+		return err
+	}
+	selector, err := appServiceSelector(myAppResource, desired, pods)
+	if err != nil {
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, service, func() error {
+		service.Labels = componentLabels(myAppResource, componentApp)
+		service.Annotations = spec.Annotations
+		service.Spec.Type = spec.Type
+		service.Spec.Selector = selector
+
+		// The node port is left to the API server, which keeps the one it allocated
+		service.Spec.Ports = []corev1.ServicePort{
+			{
+				Name:       "http",
+				Protocol:   corev1.ProtocolTCP,
+				Port:       spec.Port,
+				TargetPort: intstr.FromString("http"),
+			},
+		}
+		return ctrl.SetControllerReference(myAppResource, service, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, service, op)
+	return nil
+}
+
+// reconcileAppIngress applies the Ingress routing to the app
+// Service, or removes it once the ingress is unset.
+func (r *MyAppResourceReconciler) reconcileAppIngress(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      appServiceName(myAppResource),
+			Namespace: myAppResource.Namespace,
+		},
+	}
+	spec := myAppResource.Spec.Ingress
+	if spec == nil {
+		_, err := r.deleteControlledObjects(ctx, myAppResource, []client.Object{ingress})
+		return err
+	}
+
+	op, err := r.apply(ctx, myAppResource, ingress, func() error {
+		ingress.Labels = componentLabels(myAppResource, componentApp)
+		ingress.Spec.IngressClassName = spec.ClassName
+
+		pathType := networkingv1.PathTypePrefix
+		ingress.Spec.Rules = []networkingv1.IngressRule{
+			{
+				Host: spec.Host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{
+							{
+								Path:     spec.Path,
+								PathType: &pathType,
+								Backend: networkingv1.IngressBackend{
+									Service: &networkingv1.IngressServiceBackend{
+										Name: appServiceName(myAppResource),
+										Port: networkingv1.ServiceBackendPort{Name: "http"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		if spec.TLSSecretName != "" {
+			tls := networkingv1.IngressTLS{SecretName: spec.TLSSecretName}
+			if spec.Host != "" {
+				tls.Hosts = []string{spec.Host}
+			}
+			ingress.Spec.TLS = []networkingv1.IngressTLS{tls}
+		}
+		return ctrl.SetControllerReference(myAppResource, ingress, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+	r.recordCreated(myAppResource, ingress, op)
+	return nil
+}
+
+// ingressURL returns the address the app is reachable at through the Ingress:
+// its host, or the address of the load balancer when it serves all hosts.
+func ingressURL(myAppResource *myapigroupv1beta1.MyAppResource, ingress *networkingv1.Ingress) string {
+	spec := myAppResource.Spec.Ingress
+	scheme := "http"
+	if spec.TLSSecretName != "" {
+		scheme = "https"
+	}
+
+	host := spec.Host
+	if host == "" {
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if host = lb.Hostname; host == "" {
+				host = lb.IP
+			}
+			if host != "" {
+				break
+			}
+		}
+	}
+	if host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, host, spec.Path)
+}
@@ -0,0 +1,414 @@
+/*
+Copyright 2024 Ramakrishna Kommineni.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	myapigroupv1beta1 "github.com/kommineni24/k8appcontroller/api/v1beta1"
+)
+
+// Reasons used for the status conditions.
+const (
+	reasonReplicasReady      = "ReplicasReady"
+	reasonReplicasNotReady   = "ReplicasNotReady"
+	reasonRollingOut         = "RollingOut"
+	reasonRolloutComplete    = "RolloutComplete"
+	reasonProgressDeadline   = "ProgressDeadlineExceeded"
+	reasonReconcileError     = "ReconcileError"
+	reasonReconciled         = "Reconciled"
+	reasonRedisDisabled      = "RedisDisabled"
+	reasonDeploymentNotFound = "DeploymentNotFound"
+	reasonSpecInvalid        = "SpecInvalid"
+	reasonSpecValid          = "SpecValid"
+	reasonFieldConflict      = "FieldConflict"
+	reasonNoFieldConflict    = "NoFieldConflict"
+)
+
+// checkSpec validates the defaulted spec with the rules of the validating
+// webhook, parses it into the desired state the owned objects are rendered
+// from and records the outcome in the SpecInvalid condition. It returns a nil
+// desired state when the spec is invalid.
+func (r *MyAppResourceReconciler) checkSpec(myAppResource *myapigroupv1beta1.MyAppResource) *desiredState {
+	path := field.NewPath("spec")
+	errs := myAppResource.Spec.Validate(path)
+	var desired *desiredState
+	if len(errs) == 0 {
+		desired, errs = newDesiredState(&myAppResource.Spec, path)
+	}
+	if len(errs) == 0 {
+		meta.SetStatusCondition(&myAppResource.Status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionSpecInvalid,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonSpecValid,
+			Message:            "The spec is valid",
+			ObservedGeneration: myAppResource.Generation,
+		})
+		return desired
+	}
+
+	message := errs.ToAggregate().Error()
+	ctrl.Log.WithValues("myappresource", client.ObjectKeyFromObject(myAppResource)).Info("Spec is invalid, leaving the workloads as they are", "errors", message)
+	meta.SetStatusCondition(&myAppResource.Status.Conditions, metav1.Condition{
+		Type:               myapigroupv1beta1.ConditionSpecInvalid,
+		Status:             metav1.ConditionTrue,
+		Reason:             reasonSpecInvalid,
+		Message:            message,
+		ObservedGeneration: myAppResource.Generation,
+	})
+	specValidationFailures.WithLabelValues(myAppResource.Namespace, myAppResource.Name).Inc()
+	return nil
+}
+
+// errSpecNotApplied is reported by a pass that left the owned objects alone
+// because the spec is invalid. Nothing was applied, so the FieldConflict
+// condition keeps what the last pass that applied the objects found.
+var errSpecNotApplied = fmt.Errorf("the spec is invalid and was not applied")
+
+// updateStatus recomputes the status of the MyAppResource from the workloads it
+// owns and writes it through the status client when it differs from original,
+// the status the resource was read with. A non-nil reconcileErr is reported
+// through the Degraded condition.
+func (r *MyAppResourceReconciler) updateStatus(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource, original *myapigroupv1beta1.MyAppResourceStatus, reconcileErr error) error {
+	status := &myAppResource.Status
+	generation := myAppResource.Generation
+
+	appDeployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: myAppResource.Name}, appDeployment); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		appDeployment = nil
+	}
+
+	status.App.Replicas = myAppResource.Spec.ReplicaCount
+	if myAppResource.Spec.Autoscaling != nil && appDeployment != nil && appDeployment.Spec.Replicas != nil {
+		// The autoscaler decides how many replicas are desired
+		status.App.Replicas = *appDeployment.Spec.Replicas
+	}
+	rolloutStuck := false
+	if appDeployment == nil {
+		status.App.ReadyReplicas = 0
+		status.App.UpdatedReplicas = 0
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionAvailable,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonDeploymentNotFound,
+			Message:            "The app Deployment has not been created yet",
+			ObservedGeneration: generation,
+		})
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionProgressing,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonRollingOut,
+			Message:            "Waiting for the app Deployment to be created",
+			ObservedGeneration: generation,
+		})
+	} else {
+		status.App.ReadyReplicas = appDeployment.Status.ReadyReplicas
+		status.App.UpdatedReplicas = appDeployment.Status.UpdatedReplicas
+
+		image := containerImage(appDeployment.Spec.Template.Spec.Containers, appContainerName)
+		rolledOut := deploymentRolledOut(appDeployment)
+		if rolledOut || status.Image == "" {
+			status.Image = image
+		}
+
+		available := metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionAvailable,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonReplicasNotReady,
+			Message:            fmt.Sprintf("%d/%d replicas are ready", status.App.ReadyReplicas, status.App.Replicas),
+			ObservedGeneration: generation,
+		}
+		if status.App.ReadyReplicas >= status.App.Replicas {
+			available.Status = metav1.ConditionTrue
+			available.Reason = reasonReplicasReady
+		}
+		meta.SetStatusCondition(&status.Conditions, available)
+
+		if rolledOut {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               myapigroupv1beta1.ConditionProgressing,
+				Status:             metav1.ConditionFalse,
+				Reason:             reasonRolloutComplete,
+				Message:            fmt.Sprintf("Image %s is rolled out", image),
+				ObservedGeneration: generation,
+			})
+		} else {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               myapigroupv1beta1.ConditionProgressing,
+				Status:             metav1.ConditionTrue,
+				Reason:             reasonRollingOut,
+				Message:            fmt.Sprintf("%d/%d replicas are updated to %s", status.App.UpdatedReplicas, status.App.Replicas, image),
+				ObservedGeneration: generation,
+			})
+		}
+
+		for _, condition := range appDeployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+				rolloutStuck = true
+			}
+		}
+	}
+
+	if err := r.updateAppAccessStatus(ctx, myAppResource); err != nil {
+		return err
+	}
+
+	if err := r.updateRedisStatus(ctx, myAppResource); err != nil {
+		return err
+	}
+
+	// Another error may hide a conflict further on, so the condition is only
+	// cleared by a pass that applied every object
+	conflict, conflicting := asFieldConflict(reconcileErr)
+	switch {
+	case conflicting:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionFieldConflict,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonFieldConflict,
+			Message:            conflict.Error(),
+			ObservedGeneration: generation,
+		})
+	case reconcileErr == nil:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionFieldConflict,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonNoFieldConflict,
+			Message:            "No other field manager set fields the controller applies to other values",
+			ObservedGeneration: generation,
+		})
+	}
+
+	specInvalid := meta.FindStatusCondition(status.Conditions, myapigroupv1beta1.ConditionSpecInvalid)
+	switch {
+	case specInvalid != nil && specInvalid.Status == metav1.ConditionTrue:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonSpecInvalid,
+			Message:            specInvalid.Message,
+			ObservedGeneration: generation,
+		})
+	case conflicting:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonFieldConflict,
+			Message:            conflict.Error(),
+			ObservedGeneration: generation,
+		})
+	case reconcileErr != nil:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonReconcileError,
+			Message:            reconcileErr.Error(),
+			ObservedGeneration: generation,
+		})
+	case rolloutStuck:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionDegraded,
+			Status:             metav1.ConditionTrue,
+			Reason:             reasonProgressDeadline,
+			Message:            "The app Deployment exceeded its progress deadline",
+			ObservedGeneration: generation,
+		})
+	default:
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionDegraded,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonReconciled,
+			Message:            "All resources are reconciled",
+			ObservedGeneration: generation,
+		})
+	}
+
+	status.ObservedGeneration = generation
+	recordStatusMetrics(myAppResource)
+
+	if equality.Semantic.DeepEqual(original, status) {
+		return nil
+	}
+	if err := r.Status().Update(ctx, myAppResource); err != nil {
+		return err
+	}
+	// Events follow the status that was written, so a conflicting update
+	// records them on the retry instead of twice.
+	r.recordConditionEvents(myAppResource, original.Conditions)
+	observeRolloutDuration(myAppResource, original.Conditions)
+	return nil
+}
+
+// updateAppAccessStatus fills in the addresses the app is reachable at.
+func (r *MyAppResourceReconciler) updateAppAccessStatus(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	status := &myAppResource.Status.App
+
+	status.Endpoint = ""
+	service := &corev1.Service{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: appServiceName(myAppResource)}, service)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		status.Endpoint = appEndpoint(myAppResource)
+	}
+
+	status.URL = ""
+	if myAppResource.Spec.Ingress == nil {
+		return nil
+	}
+	ingress := &networkingv1.Ingress{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: appServiceName(myAppResource)}, ingress)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		status.URL = ingressURL(myAppResource, ingress)
+	}
+	return nil
+}
+
+// updateRedisStatus fills in the Redis replica counts and the RedisReady condition.
+func (r *MyAppResourceReconciler) updateRedisStatus(ctx context.Context, myAppResource *myapigroupv1beta1.MyAppResource) error {
+	status := &myAppResource.Status
+	generation := myAppResource.Generation
+
+	if !myAppResource.Spec.Redis.Enabled {
+		// Keep reporting what was removed when Redis was disabled
+		status.Redis = myapigroupv1beta1.RedisStatus{Removed: status.Redis.Removed}
+		message := "Redis is not enabled"
+		if len(status.Redis.Removed) > 0 {
+			message = fmt.Sprintf("Redis is not enabled; removed %s", strings.Join(status.Redis.Removed, ", "))
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               myapigroupv1beta1.ConditionRedisReady,
+			Status:             metav1.ConditionFalse,
+			Reason:             reasonRedisDisabled,
+			Message:            message,
+			ObservedGeneration: generation,
+		})
+		return nil
+	}
+
+	status.Redis.Removed = nil
+	status.Redis.Replicas = redisReplicas(myAppResource)
+	redisStatefulSet := &appsv1.StatefulSet{}
+	err := r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisName(myAppResource)}, redisStatefulSet)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if errors.IsNotFound(err) {
+		status.Redis.ReadyReplicas = 0
+		status.Redis.UpdatedReplicas = 0
+	} else {
+		status.Redis.ReadyReplicas = redisStatefulSet.Status.ReadyReplicas
+		status.Redis.UpdatedReplicas = redisStatefulSet.Status.UpdatedReplicas
+	}
+
+	status.Redis.Endpoint = ""
+	redisService := &corev1.Service{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisServiceName(myAppResource)}, redisService)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		status.Redis.Endpoint = redisEndpoint(myAppResource)
+	}
+
+	status.Redis.PasswordSecret = ""
+	status.Redis.LastPasswordRotationTime = nil
+	redisSecret := &corev1.Secret{}
+	err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisAuthSecretName(myAppResource)}, redisSecret)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil {
+		status.Redis.PasswordSecret = redisSecret.Name
+		status.Redis.LastPasswordRotationTime = redisPasswordRotatedAt(redisSecret)
+	}
+
+	sentinelsReady := true
+	if redisSentinelMode(myAppResource) {
+		// Primary and Failovers are kept up to date by reconcileRedisPrimary
+		if status.Redis.Sentinel == nil {
+			status.Redis.Sentinel = &myapigroupv1beta1.WorkloadStatus{}
+		}
+		status.Redis.Sentinel.Replicas = redisSentinelReplicas(myAppResource)
+		sentinelStatefulSet := &appsv1.StatefulSet{}
+		err = r.Get(ctx, client.ObjectKey{Namespace: myAppResource.Namespace, Name: redisSentinelName(myAppResource)}, sentinelStatefulSet)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if errors.IsNotFound(err) {
+			status.Redis.Sentinel.ReadyReplicas = 0
+			status.Redis.Sentinel.UpdatedReplicas = 0
+		} else {
+			status.Redis.Sentinel.ReadyReplicas = sentinelStatefulSet.Status.ReadyReplicas
+			status.Redis.Sentinel.UpdatedReplicas = sentinelStatefulSet.Status.UpdatedReplicas
+		}
+		sentinelsReady = status.Redis.Sentinel.ReadyReplicas >= status.Redis.Sentinel.Replicas
+	} else {
+		status.Redis.Primary = ""
+		status.Redis.Failovers = 0
+		status.Redis.Sentinel = nil
+	}
+
+	condition := metav1.Condition{
+		Type:               myapigroupv1beta1.ConditionRedisReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reasonReplicasNotReady,
+		Message:            fmt.Sprintf("%d/%d Redis replicas are ready", status.Redis.ReadyReplicas, status.Redis.Replicas),
+		ObservedGeneration: generation,
+	}
+	if status.Redis.Sentinel != nil {
+		condition.Message = fmt.Sprintf("%d/%d Redis replicas and %d/%d sentinels are ready",
+			status.Redis.ReadyReplicas, status.Redis.Replicas, status.Redis.Sentinel.ReadyReplicas, status.Redis.Sentinel.Replicas)
+	}
+	if status.Redis.ReadyReplicas >= status.Redis.Replicas && sentinelsReady {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonReplicasReady
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+	return nil
+}
+
+// containerImage returns the image of the named container, or an empty string
+// when the container is not present.
+func containerImage(containers []corev1.Container, name string) string {
+	for _, container := range containers {
+		if container.Name == name {
+			return container.Image
+		}
+	}
+	return ""
+}